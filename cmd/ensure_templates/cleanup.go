@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+	l "github.com/tetratelabs/log"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
+	t "github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+// cleanup deletes the daily Zipkin indices older than the configured retention
+// of their type. This is for clusters without lifecycle policy support.
+func cleanup(args []string) {
+	// init our defaults
+	var settings = struct {
+		templateSettings
+		conn          connectionSettings
+		dateSeparator string
+		dryRun        bool
+	}{
+		templateSettings: defaultTemplateSettings(),
+		conn:             defaultConnectionSettings(),
+		dateSeparator:    "-",
+	}
+	// os env override
+	{
+		settings.loadEnv()
+		settings.conn.loadEnv()
+		if str, found := os.LookupEnv("ES_DATE_SEPARATOR"); found {
+			settings.dateSeparator = str
+		}
+		if envEnabled("DRY_RUN") {
+			settings.dryRun = true
+		}
+	}
+
+	// flag handling
+	{
+		fs := pflag.NewFlagSet("cleanup settings", pflag.ContinueOnError)
+		fs.SortFlags = false
+		fs.StringVarP(&settings.IndexPrefix, "prefix", "p",
+			settings.IndexPrefix, "index name prefix")
+		settings.attachRetentionToFlagSet(fs)
+		fs.StringVar(&settings.dateSeparator, "date-separator", settings.dateSeparator,
+			"separator used in the index date suffix, as configured in Zipkin (may be empty)")
+		fs.BoolVar(&settings.dryRun, "dry-run", settings.dryRun,
+			"print the indices to delete without deleting them")
+		settings.conn.attachToFlagSet(fs)
+
+		logOpts.AttachToFlagSet(fs)
+
+		// parse FlagSet and exit on error
+		if err := fs.Parse(args); err != nil {
+			if err == pflag.ErrHelp {
+				os.Exit(0)
+			}
+			fmt.Printf("unable to parse settings: %+v\n", err)
+			os.Exit(1)
+		}
+
+		if len(settings.dateSeparator) > 1 {
+			fmt.Printf("invalid date-separator: %q\n", settings.dateSeparator)
+			os.Exit(1)
+		}
+		if !settings.retentionEnabled() {
+			fmt.Println("no retention configured")
+			os.Exit(1)
+		}
+		if err := settings.conn.resolve(); err != nil {
+			fmt.Printf("%+v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// initialize the logging subsystem
+	if err := l.Configure(logOpts); err != nil {
+		fmt.Printf("failed to configure logging: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := settings.conn.context()
+	defer cancel()
+
+	client, err := settings.conn.connect(ctx)
+	if err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(exitCode(err))
+	}
+	tplSvc, err := t.New(settings.Config, client.Version())
+	if err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(1)
+	}
+
+	p, err := planCleanup(ctx, client, tplSvc, settings.dateSeparator, time.Now())
+	if err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(1)
+	}
+	p.print(os.Stdout)
+	if settings.dryRun {
+		return
+	}
+	if err = p.apply(); err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(1)
+	}
+}
+
+// planCleanup plans the removal of the daily indices older than the retention
+// configured for their type. The retention is counted in whole UTC days, which
+// is how Zipkin names its indices.
+func planCleanup(ctx context.Context, client *es.Client, tplSvc *t.Service, dateSeparator string, now time.Time) (plan, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+
+	var p plan
+	for _, templateType := range templateTypes {
+		days := tplSvc.RetentionDays(templateType)
+		if days <= 0 {
+			continue
+		}
+		cutoff := today.AddDate(0, 0, -days)
+
+		indices, err := client.GetIndices(ctx, tplSvc.IndexPattern(templateType))
+		if err != nil {
+			return nil, fmt.Errorf("unable to get %s indices: %w", templateType, err)
+		}
+		var expired []string
+		for _, index := range indices {
+			date, ok := tplSvc.IndexDate(templateType, index.Index, dateSeparator)
+			if !ok {
+				log.Debugf("skipping %q, not a daily %s index", index.Index, templateType)
+				continue
+			}
+			if date.Before(cutoff) {
+				expired = append(expired, index.Index)
+			}
+		}
+		if len(expired) == 0 {
+			continue
+		}
+		p = append(p, action{
+			kind:    actionDelete,
+			desc:    fmt.Sprintf("%s indices older than %d days", templateType, days),
+			key:     tplSvc.IndexPattern(templateType),
+			details: expired,
+			apply:   func() (string, error) { return deleteIndices(ctx, client, expired) },
+		})
+	}
+	return p, nil
+}
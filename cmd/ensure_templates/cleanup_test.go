@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	t "github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+const elasticsearch710 = `{"version":{"number":"7.10.2"}}`
+
+func TestPlanCleanup(tt *testing.T) {
+	// mid-day, the retention is counted in whole UTC days
+	now := time.Date(2026, 10, 16, 13, 45, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	for _, item := range []struct {
+		name      string
+		retention int
+		separator string
+		indices   []string
+		want      []string
+	}{
+		{"cutoff", 7, "-", []string{
+			"zipkin-span-2026-10-07",
+			"zipkin-span-2026-10-08",
+			"zipkin-span-2026-10-09", // exactly 7 days old
+			"zipkin-span-2026-10-16",
+		}, []string{"zipkin-span-2026-10-07", "zipkin-span-2026-10-08"}},
+		{"dot separator", 1, ".", []string{
+			"zipkin-span-2026.10.14",
+			"zipkin-span-2026.10.15",
+			"zipkin-span-2026-10-01", // other separator
+		}, []string{"zipkin-span-2026.10.14"}},
+		{"no separator", 1, "", []string{
+			"zipkin-span-20261014",
+			"zipkin-span-20261015",
+		}, []string{"zipkin-span-20261014"}},
+		{"not daily indices", 1, "-", []string{
+			"zipkin-span-2026-10-01-reindexed",
+			"zipkin-span-archive",
+			"zipkin-span-2026-13-01",
+		}, nil},
+		{"no retention", 0, "-", []string{"zipkin-span-2020-01-01"}, nil},
+	} {
+		cfg := t.DefaultConfig()
+		cfg.SpanRetentionDays = item.retention
+		tplSvc, err := t.New(cfg, t.ElasticsearchVersion(7, 10))
+		if err != nil {
+			tt.Fatalf("unable to create service: %v", err)
+		}
+
+		var requested []string
+		client := newTestClient(tt, elasticsearch710, func(w http.ResponseWriter, r *http.Request) {
+			requested = append(requested, r.URL.Path)
+			if !strings.HasPrefix(r.URL.Path, "/_cat/indices/") {
+				tt.Errorf("%s: unexpected request: %s %s", item.name, r.Method, r.URL)
+			}
+			var indices []map[string]string
+			for _, index := range item.indices {
+				indices = append(indices, map[string]string{"index": index, "docs.count": "1", "store.size": "1024"})
+			}
+			_ = json.NewEncoder(w).Encode(indices)
+		})
+
+		p, err := planCleanup(context.Background(), client, tplSvc, item.separator, now)
+		if err != nil {
+			tt.Fatalf("%s: unable to plan: %v", item.name, err)
+		}
+		if item.retention <= 0 && len(requested) > 0 {
+			tt.Errorf("%s: want no requests without retention, got: %v", item.name, requested)
+		}
+		if item.want == nil {
+			if len(p) != 0 {
+				tt.Errorf("%s: want no actions, got: %+v", item.name, p)
+			}
+			continue
+		}
+		if len(p) != 1 || p[0].kind != actionDelete || p[0].key != "zipkin-span-*" {
+			tt.Errorf("%s: want a single delete of zipkin-span-*, got: %+v", item.name, p)
+			continue
+		}
+		if !reflect.DeepEqual(p[0].details, item.want) {
+			tt.Errorf("%s: want indices: %v, got: %v", item.name, item.want, p[0].details)
+		}
+	}
+}
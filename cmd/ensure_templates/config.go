@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	t "github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+// templateSettings holds the settings controlling template generation, shared
+// by the commands generating templates.
+type templateSettings struct {
+	t.Config
+	templateAPI          string
+	disableStrictTraceID bool
+	disableSearch        bool
+}
+
+func defaultTemplateSettings() templateSettings {
+	return templateSettings{
+		Config:      t.DefaultConfig(),
+		templateAPI: templateAPIAuto,
+	}
+}
+
+// loadEnv overrides the settings with the ones found in the environment.
+func (s *templateSettings) loadEnv() {
+	if str := os.Getenv("INDEX_PREFIX"); str != "" {
+		s.IndexPrefix = str
+	}
+	if str := os.Getenv("INDEX_REPLICAS"); str != "" {
+		if i, err := strconv.ParseInt(str, 10, 32); err == nil {
+			s.IndexReplicas = int(i)
+		}
+	}
+	if str := os.Getenv("INDEX_SHARDS"); str != "" {
+		if i, err := strconv.ParseInt(str, 10, 32); err == nil {
+			s.IndexShards = int(i)
+		}
+	}
+	if str := os.Getenv("ES_TEMPLATE_PRIORITY"); str != "" {
+		if i, err := strconv.ParseInt(str, 10, 32); err == nil {
+			s.TemplatePriority = int(i)
+		}
+	}
+	if str := os.Getenv("TEMPLATE_API"); str != "" {
+		s.templateAPI = strings.ToLower(str)
+	}
+	if str := os.Getenv("SPAN_RETENTION_DAYS"); str != "" {
+		if i, err := strconv.ParseInt(str, 10, 32); err == nil {
+			s.SpanRetentionDays = int(i)
+		}
+	}
+	if str := os.Getenv("DEPENDENCY_RETENTION_DAYS"); str != "" {
+		if i, err := strconv.ParseInt(str, 10, 32); err == nil {
+			s.DependencyRetentionDays = int(i)
+		}
+	}
+	if str := os.Getenv("AUTOCOMPLETE_RETENTION_DAYS"); str != "" {
+		if i, err := strconv.ParseInt(str, 10, 32); err == nil {
+			s.AutoCompleteRetentionDays = int(i)
+		}
+	}
+	if envEnabled("DISABLE_STRICT_TRACEID") {
+		s.disableStrictTraceID = true
+	}
+	if envEnabled("DISABLE_SEARCH") {
+		s.disableSearch = true
+	}
+}
+
+func (s *templateSettings) attachToFlagSet(fs *pflag.FlagSet) {
+	fs.StringVarP(&s.IndexPrefix, "prefix", "p",
+		s.IndexPrefix, "index template name prefix")
+	fs.IntVarP(&s.IndexReplicas, "replicas", "r",
+		s.IndexReplicas, "index replica count")
+	fs.IntVarP(&s.IndexShards, "shards", "s", s.IndexShards,
+		"index shard count")
+	fs.IntVar(&s.TemplatePriority, "template-priority",
+		s.TemplatePriority, "composable index template priority")
+	fs.StringVar(&s.templateAPI, "template-api", s.templateAPI,
+		"index template API to use, one of [auto, legacy, composable]")
+	s.attachRetentionToFlagSet(fs)
+	fs.BoolVar(&s.disableStrictTraceID, "disable-strict-traceId",
+		s.disableStrictTraceID,
+		"disable strict traceID (when migrating between 64-128bit)")
+	fs.BoolVar(&s.disableSearch, "disable-search",
+		s.disableSearch,
+		"disable search indexes (if not using Zipkin UI)")
+}
+
+// attachRetentionToFlagSet attaches the retention flags only, for commands not
+// generating templates.
+func (s *templateSettings) attachRetentionToFlagSet(fs *pflag.FlagSet) {
+	fs.IntVar(&s.SpanRetentionDays, "span-retention-days",
+		s.SpanRetentionDays, "delete span indices after days (0 keeps them)")
+	fs.IntVar(&s.DependencyRetentionDays, "dependency-retention-days",
+		s.DependencyRetentionDays, "delete dependency indices after days (0 keeps them)")
+	fs.IntVar(&s.AutoCompleteRetentionDays, "autocomplete-retention-days",
+		s.AutoCompleteRetentionDays, "delete autocomplete indices after days (0 keeps them)")
+}
+
+// resolve validates the parsed settings and derives the templater Config.
+func (s *templateSettings) resolve() error {
+	switch s.templateAPI {
+	case templateAPIAuto, templateAPILegacy, templateAPIComposable:
+	default:
+		return fmt.Errorf("invalid template-api: %q", s.templateAPI)
+	}
+
+	s.StrictTraceID = !s.disableStrictTraceID
+	s.SearchEnabled = !s.disableSearch
+	return nil
+}
+
+// retentionEnabled returns true if a retention is configured for any type.
+func (s templateSettings) retentionEnabled() bool {
+	for _, typ := range templateTypes {
+		if s.RetentionDays(typ) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// useComposable returns true if composable index templates are to be used
+// given the template-api setting and whether the cluster supports them.
+func (s templateSettings) useComposable(supported bool) (bool, error) {
+	switch s.templateAPI {
+	case templateAPILegacy:
+		return false, nil
+	case templateAPIComposable:
+		if !supported {
+			return false, errors.New("composable index templates not supported")
+		}
+	}
+	return supported, nil
+}
+
+// envEnabled returns true if the environment variable is set to a truthy value.
+func envEnabled(name string) bool {
+	str, found := os.LookupEnv(name)
+	if !found {
+		return false
+	}
+	str = strings.ToLower(str)
+	return str == "1" || str == "yes" || str == "on"
+}
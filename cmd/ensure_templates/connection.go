@@ -0,0 +1,667 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/credentials"
+	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
+)
+
+// exit code used when the cluster did not become ready within wait-timeout
+const exitWaitTimeout = 3
+
+// errWaitTimeout is returned by connect if the cluster did not become ready
+// within wait-timeout.
+var errWaitTimeout = errors.New("timed out waiting for the cluster")
+
+// bounds of the exponential backoff between connection attempts
+const (
+	minWaitBackoff = 500 * time.Millisecond
+	maxWaitBackoff = 30 * time.Second
+)
+
+// connectionSettings holds the settings to connect to the cluster, shared by
+// the commands working against a cluster.
+type connectionSettings struct {
+	host           string
+	hostSet        bool // by the environment or a flag, not defaulted
+	cloudID        string
+	cloudAuth      string
+	sniff          bool
+	tls            es.TLSConfig
+	user           string
+	pass           string
+	apiKey         string
+	bearerToken    string
+	sigV4          bool
+	awsRegion      string
+	awsService     string
+	awsProfile     string
+	aws            credentials.AWSCredentials
+	credFile       string
+	credDir        string
+	credCmdConfig  credentials.CommandConfig
+	credCmd        *credentials.Command
+	vault          credentials.VaultConfig
+	waitTimeout    time.Duration
+	waitForStatus  string
+	retry          es.RetryPolicy
+	requestTimeout time.Duration
+	totalTimeout   time.Duration
+	// files holding the credentials, as with Docker secrets
+	userFile        string
+	passFile        string
+	apiKeyFile      string
+	bearerTokenFile string
+	// flags the settings are attached to
+	flags *pflag.FlagSet
+	// flag values overriding the environment
+	flagUser        string
+	flagPass        string
+	flagAPIKey      string
+	flagBearerToken string
+}
+
+func defaultConnectionSettings() connectionSettings {
+	cfg := es.DefaultConfig()
+	return connectionSettings{
+		host:           strings.Join(cfg.Hosts, ","),
+		awsService:     "es",
+		credCmdConfig:  credentials.CommandConfig{Timeout: credentials.DefaultCommandTimeout},
+		retry:          cfg.Retry,
+		requestTimeout: time.Minute,
+	}
+}
+
+// loadEnv overrides the settings with the ones found in the environment.
+func (s *connectionSettings) loadEnv() {
+	// ES_HOSTS as used by Zipkin, ES_HOST takes precedence
+	if str := os.Getenv("ES_HOSTS"); str != "" {
+		s.host, s.hostSet = str, true
+	}
+	if str := os.Getenv("ES_HOST"); str != "" {
+		s.host, s.hostSet = str, true
+	}
+	s.cloudID, _ = os.LookupEnv("ES_CLOUD_ID")
+	s.cloudAuth, _ = os.LookupEnv("ES_CLOUD_AUTH")
+	if envEnabled("ES_SNIFF") {
+		s.sniff = true
+	}
+	s.tls.CABundle, _ = os.LookupEnv("CA_BUNDLE")
+	s.tls.CAFingerprint, _ = os.LookupEnv("ES_CA_FINGERPRINT")
+	s.tls.ClientCert, _ = os.LookupEnv("ES_CLIENT_CERT")
+	s.tls.ClientKey, _ = os.LookupEnv("ES_CLIENT_KEY")
+	s.tls.ClientKeyPassword, _ = os.LookupEnv("ES_CLIENT_KEY_PASSWORD")
+	s.user, _ = os.LookupEnv("ES_USERNAME")
+	s.pass, _ = os.LookupEnv("ES_PASSWORD")
+	s.apiKey, _ = os.LookupEnv("ES_API_KEY")
+	s.bearerToken, _ = os.LookupEnv("ES_BEARER_TOKEN")
+	if envEnabled("ES_AWS_SIGV4") {
+		s.sigV4 = true
+	}
+	// AWS_REGION as used by the AWS SDKs, AWS_DEFAULT_REGION as by the CLI
+	if str := os.Getenv("AWS_DEFAULT_REGION"); str != "" {
+		s.awsRegion = str
+	}
+	if str := os.Getenv("AWS_REGION"); str != "" {
+		s.awsRegion = str
+	}
+	if str := os.Getenv("ES_AWS_SERVICE"); str != "" {
+		s.awsService = str
+	}
+	s.userFile, _ = os.LookupEnv("ES_USERNAME_FILE")
+	s.passFile, _ = os.LookupEnv("ES_PASSWORD_FILE")
+	s.apiKeyFile, _ = os.LookupEnv("ES_API_KEY_FILE")
+	s.bearerTokenFile, _ = os.LookupEnv("ES_BEARER_TOKEN_FILE")
+	s.credFile, _ = os.LookupEnv("DB_CREDENTIALS_FILE")
+	s.credDir, _ = os.LookupEnv("ES_CREDENTIALS_DIR")
+	s.credCmdConfig.Command, _ = os.LookupEnv("ES_CREDENTIALS_COMMAND")
+	s.credCmdConfig.Format, _ = os.LookupEnv("ES_CREDENTIALS_COMMAND_FORMAT")
+	if str := os.Getenv("ES_CREDENTIALS_COMMAND_TIMEOUT"); str != "" {
+		if d, err := time.ParseDuration(str); err == nil {
+			s.credCmdConfig.Timeout = d
+		}
+	}
+	if str := os.Getenv("ES_CREDENTIALS_CACHE_TTL"); str != "" {
+		if d, err := time.ParseDuration(str); err == nil {
+			s.credCmdConfig.CacheTTL = d
+		}
+	}
+	// VAULT_* as used by the Vault CLI
+	s.vault.Address, _ = os.LookupEnv("VAULT_ADDR")
+	s.vault.CACert, _ = os.LookupEnv("VAULT_CACERT")
+	s.vault.Namespace, _ = os.LookupEnv("VAULT_NAMESPACE")
+	s.vault.Token, _ = os.LookupEnv("VAULT_TOKEN")
+	s.vault.KubernetesRole, _ = os.LookupEnv("VAULT_K8S_ROLE")
+	s.vault.KubernetesMount, _ = os.LookupEnv("VAULT_K8S_MOUNT")
+	s.vault.SecretPath, _ = os.LookupEnv("VAULT_SECRET_PATH")
+	if str := os.Getenv("ES_WAIT_TIMEOUT"); str != "" {
+		if d, err := time.ParseDuration(str); err == nil {
+			s.waitTimeout = d
+		}
+	}
+	if str := os.Getenv("ES_WAIT_FOR_STATUS"); str != "" {
+		s.waitForStatus = strings.ToLower(str)
+	}
+	if str := os.Getenv("ES_RETRY_MAX_ATTEMPTS"); str != "" {
+		if i, err := strconv.ParseInt(str, 10, 32); err == nil {
+			s.retry.MaxAttempts = int(i)
+		}
+	}
+	if str := os.Getenv("ES_RETRY_BACKOFF"); str != "" {
+		if d, err := time.ParseDuration(str); err == nil {
+			s.retry.InitialBackoff = d
+		}
+	}
+	if str := os.Getenv("ES_RETRY_MAX_BACKOFF"); str != "" {
+		if d, err := time.ParseDuration(str); err == nil {
+			s.retry.MaxBackoff = d
+		}
+	}
+	if str := os.Getenv("ES_REQUEST_TIMEOUT"); str != "" {
+		if d, err := time.ParseDuration(str); err == nil {
+			s.requestTimeout = d
+		}
+	}
+	if str := os.Getenv("ES_TOTAL_TIMEOUT"); str != "" {
+		if d, err := time.ParseDuration(str); err == nil {
+			s.totalTimeout = d
+		}
+	}
+}
+
+func (s *connectionSettings) attachToFlagSet(fs *pflag.FlagSet) {
+	s.flags = fs
+	fs.StringVarP(&s.host, "host", "H", s.host,
+		"Elasticsearch host URL, or a comma separated list of host URLs")
+	fs.StringVar(&s.cloudID, "cloud-id", s.cloudID,
+		"Elastic Cloud ID of the deployment, used instead of host")
+	fs.StringVar(&s.cloudAuth, "cloud-auth", s.cloudAuth,
+		"basic auth credentials as user:pass, a shorthand for es-username and es-password")
+	fs.BoolVar(&s.sniff, "sniff", s.sniff,
+		"send requests to the data nodes found through the hosts")
+	fs.StringVar(&s.tls.CABundle, "ca-bundle", s.tls.CABundle, "ca-bundle for self signed https")
+	fs.StringVar(&s.tls.CAFingerprint, "ca-fingerprint", s.tls.CAFingerprint,
+		"SHA-256 fingerprint of the https CA certificate (as printed by Elasticsearch 8.x on first start)")
+	fs.StringVar(&s.tls.ClientCert, "client-cert", s.tls.ClientCert,
+		"PEM client certificate for mutual TLS (reloaded when changed)")
+	fs.StringVar(&s.tls.ClientKey, "client-key", s.tls.ClientKey,
+		"PEM private key of the client certificate (reloaded when changed)")
+	fs.StringVar(&s.tls.ClientKeyPassword, "client-key-password", s.tls.ClientKeyPassword,
+		"password of an encrypted client key (PKCS#8 with PBES2 or traditional OpenSSL encryption)")
+	fs.StringVar(&s.flagUser, "es-username", "", "basic auth username (or template if using credentials file)")
+	fs.StringVar(&s.flagPass, "es-password", "", "basic auth password (or template if using credentials file")
+	fs.StringVar(&s.flagAPIKey, "es-api-key", "",
+		"API key, as encoded or id:api_key (or template if using credentials file)")
+	fs.StringVar(&s.flagBearerToken, "es-bearer-token", "",
+		"bearer token (or template if using credentials file)")
+	fs.BoolVar(&s.sigV4, "aws-sigv4", s.sigV4,
+		"sign requests with AWS SigV4, for Amazon OpenSearch Service domains using IAM auth")
+	fs.StringVar(&s.awsRegion, "aws-region", s.awsRegion, "AWS region of the domain")
+	fs.StringVar(&s.awsService, "aws-service", s.awsService,
+		"AWS service to sign for, es for domains or aoss for OpenSearch Serverless")
+	fs.StringVar(&s.awsProfile, "aws-profile", s.awsProfile,
+		"profile of the AWS shared credentials file (default AWS_PROFILE or default)")
+	fs.StringVar(&s.credFile, "es-credentials-file", s.credFile, "supply a credentials file")
+	fs.StringVar(&s.credDir, "es-credentials-dir", s.credDir,
+		"directory holding one file per credential (username, password, api_key, token), as Kubernetes mounts secrets")
+	fs.StringVar(&s.credCmdConfig.Command, "es-credentials-command", s.credCmdConfig.Command,
+		"credential helper command printing the credentials as JSON, YAML or key=value (run without a shell)")
+	fs.StringVar(&s.credCmdConfig.Format, "es-credentials-command-format", s.credCmdConfig.Format,
+		"output format of the credential helper, one of [json, yaml, kv] (default detected)")
+	fs.DurationVar(&s.credCmdConfig.Timeout, "es-credentials-command-timeout", s.credCmdConfig.Timeout,
+		"timeout of the credential helper")
+	fs.DurationVar(&s.credCmdConfig.CacheTTL, "es-credentials-cache-ttl", s.credCmdConfig.CacheTTL,
+		"run the credential helper again once its credentials are older (0 runs it once)")
+	fs.StringVar(&s.vault.Address, "vault-addr", s.vault.Address, "Vault address to read the credentials from")
+	fs.StringVar(&s.vault.CACert, "vault-ca-cert", s.vault.CACert, "CA certificate of the Vault server")
+	fs.StringVar(&s.vault.Namespace, "vault-namespace", s.vault.Namespace, "Vault Enterprise namespace")
+	fs.StringVar(&s.vault.Token, "vault-token", s.vault.Token, "Vault token")
+	fs.StringVar(&s.vault.KubernetesRole, "vault-k8s-role", s.vault.KubernetesRole,
+		"Vault role to log in as with the Kubernetes service account token")
+	fs.StringVar(&s.vault.KubernetesMount, "vault-k8s-mount", s.vault.KubernetesMount,
+		"mount path of the Vault Kubernetes auth method (default kubernetes)")
+	fs.StringVar(&s.vault.SecretPath, "vault-secret-path", s.vault.SecretPath,
+		"Vault path of the credentials, e.g. database/creds/zipkin or secret/data/zipkin")
+	fs.DurationVar(&s.waitTimeout, "wait-timeout", s.waitTimeout,
+		"wait up to the duration for the cluster to become reachable (0 fails immediately)")
+	fs.StringVar(&s.waitForStatus, "wait-for-status", s.waitForStatus,
+		"wait for the cluster health to reach the status, one of [yellow, green] (requires wait-timeout)")
+	fs.IntVar(&s.retry.MaxAttempts, "retry-max-attempts", s.retry.MaxAttempts,
+		"attempts per request failing with a transient error (1 disables retries)")
+	fs.DurationVar(&s.retry.InitialBackoff, "retry-backoff", s.retry.InitialBackoff,
+		"backoff before the first retry, doubled on each retry")
+	fs.DurationVar(&s.retry.MaxBackoff, "retry-max-backoff", s.retry.MaxBackoff,
+		"maximum backoff between retries")
+	fs.DurationVar(&s.requestTimeout, "request-timeout", s.requestTimeout,
+		"timeout of each request attempt (0 disables the timeout)")
+	fs.DurationVar(&s.totalTimeout, "total-timeout", s.totalTimeout,
+		"timeout of the whole command, including retries and waits (0 disables the timeout)")
+}
+
+// resolve applies the flag overrides and retrieves the credentials.
+func (s *connectionSettings) resolve() error {
+	// the _FILE variants of the credential variables, as with Docker secrets
+	for _, secret := range []struct {
+		env   string
+		file  string
+		value *string
+	}{
+		{"ES_USERNAME", s.userFile, &s.user},
+		{"ES_PASSWORD", s.passFile, &s.pass},
+		{"ES_API_KEY", s.apiKeyFile, &s.apiKey},
+		{"ES_BEARER_TOKEN", s.bearerTokenFile, &s.bearerToken},
+	} {
+		if secret.file == "" {
+			continue
+		}
+		if *secret.value != "" {
+			return fmt.Errorf("both %s and %s_FILE are set", secret.env, secret.env)
+		}
+		value, err := credentials.ReadSecret(secret.file)
+		if err != nil {
+			return fmt.Errorf("unable to read %s_FILE: %w", secret.env, err)
+		}
+		*secret.value = value
+	}
+	if s.cloudID != "" {
+		// the Cloud ID replaces the host, so an explicit host is a mistake
+		if s.hostSet || (s.flags != nil && s.flags.Changed("host")) {
+			return errors.New("both cloud-id and host are set, the Cloud ID already holds the host")
+		}
+		host, err := es.ParseCloudID(s.cloudID)
+		if err != nil {
+			return err
+		}
+		s.host = host
+	}
+	if s.credDir != "" {
+		if s.credFile != "" || s.vault.SecretPath != "" {
+			return errors.New("es-credentials-dir can not be combined with es-credentials-file or vault-secret-path")
+		}
+		creds, err := credentials.ReadDir(s.credDir)
+		if err != nil {
+			return fmt.Errorf("unable to read es-credentials-dir: %w", err)
+		}
+		// keys not found in the directory keep their values, the explicit
+		// credentials applied below take precedence
+		for _, c := range []struct {
+			value string
+			dst   *string
+		}{
+			{creds.Username, &s.user},
+			{creds.Password, &s.pass},
+			{creds.APIKey, &s.apiKey},
+			{creds.BearerToken, &s.bearerToken},
+		} {
+			if c.value != "" {
+				*c.dst = c.value
+			}
+		}
+	}
+	if s.cloudAuth != "" {
+		kv := strings.SplitN(s.cloudAuth, ":", 2)
+		if len(kv) != 2 {
+			return errors.New("invalid cloud-auth, expected user:pass")
+		}
+		s.user, s.pass = kv[0], kv[1]
+	}
+	if s.flagUser != "" {
+		s.user = s.flagUser
+	}
+	if s.flagPass != "" {
+		s.pass = s.flagPass
+	}
+	if s.flagAPIKey != "" {
+		s.apiKey = s.flagAPIKey
+	}
+	if s.flagBearerToken != "" {
+		s.bearerToken = s.flagBearerToken
+	}
+	switch s.waitForStatus {
+	case "":
+	case "yellow", "green":
+		if s.waitTimeout <= 0 {
+			return errors.New("wait-for-status requires wait-timeout")
+		}
+	default:
+		return fmt.Errorf("invalid wait-for-status: %q", s.waitForStatus)
+	}
+	if (s.tls.ClientCert == "") != (s.tls.ClientKey == "") {
+		return errors.New("client-cert and client-key are both required")
+	}
+	if s.retry.MaxAttempts < 1 {
+		return fmt.Errorf("invalid retry-max-attempts: %d", s.retry.MaxAttempts)
+	}
+
+	if s.credCmdConfig.Command != "" {
+		if s.credFile != "" || s.credDir != "" || s.vault.SecretPath != "" {
+			return errors.New("es-credentials-command can not be combined with es-credentials-file, es-credentials-dir or vault-secret-path")
+		}
+		s.credCmdConfig.Templates = credentials.Templates{
+			Username:    s.user,
+			Password:    s.pass,
+			APIKey:      s.apiKey,
+			BearerToken: s.bearerToken,
+		}
+		cmd, err := credentials.NewCommand(s.credCmdConfig)
+		if err != nil {
+			return err
+		}
+		s.credCmd = cmd
+	}
+	if s.vault.SecretPath != "" {
+		switch {
+		case s.credFile != "":
+			return errors.New("es-credentials-file and vault-secret-path are mutually exclusive")
+		case s.vault.Address == "":
+			return errors.New("vault-secret-path requires vault-addr")
+		case s.vault.Token == "" && s.vault.KubernetesRole == "":
+			return errors.New("vault-secret-path requires vault-token or vault-k8s-role")
+		}
+	}
+	if s.credFile != "" {
+		creds, err := credentials.Read(s.credFile, credentials.Templates{
+			Username:    s.user,
+			Password:    s.pass,
+			APIKey:      s.apiKey,
+			BearerToken: s.bearerToken,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to retrieve credentials: %w", err)
+		}
+		s.user, s.pass = creds.Username, creds.Password
+		s.apiKey, s.bearerToken = creds.APIKey, creds.BearerToken
+	}
+	if s.sigV4 {
+		if s.awsRegion == "" {
+			return errors.New("aws-sigv4 requires aws-region")
+		}
+		aws, err := credentials.ReadAWS(s.awsProfile)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve AWS credentials: %w", err)
+		}
+		s.aws = aws
+	}
+	return nil
+}
+
+// auth returns the authenticator of the configured credentials. SigV4 signing
+// takes precedence over the credentials command and the other credentials.
+func (s connectionSettings) auth() es.Authenticator {
+	switch {
+	case s.sigV4:
+		return es.SigV4Auth{
+			AccessKeyID:     s.aws.AccessKeyID,
+			SecretAccessKey: s.aws.SecretAccessKey,
+			SessionToken:    s.aws.SessionToken,
+			Region:          s.awsRegion,
+			Service:         s.awsService,
+		}
+	case s.credCmd != nil:
+		return commandAuth{cmd: s.credCmd}
+	}
+	return credentialsAuth(credentials.Credentials{
+		Username:    s.user,
+		Password:    s.pass,
+		APIKey:      s.apiKey,
+		BearerToken: s.bearerToken,
+	})
+}
+
+// credentialsAuth returns the authenticator of the credentials, nil if there
+// are none. An API key takes precedence over a bearer token, which takes
+// precedence over basic auth.
+func credentialsAuth(c credentials.Credentials) es.Authenticator {
+	switch {
+	case c.APIKey != "":
+		return es.APIKeyAuth{APIKey: c.APIKey}
+	case c.BearerToken != "":
+		return es.BearerAuth{Token: c.BearerToken}
+	case c.Username != "" || c.Password != "":
+		return es.BasicAuth{Username: c.Username, Password: c.Password}
+	}
+	return nil
+}
+
+// commandAuth authenticates with the credentials of the credentials command,
+// which runs again once the cached credentials expire.
+type commandAuth struct {
+	cmd *credentials.Command
+}
+
+// Authenticate implements es.Authenticator.
+func (a commandAuth) Authenticate(req *http.Request) error {
+	creds, err := a.cmd.Get(req.Context())
+	if err != nil {
+		return err
+	}
+	auth := credentialsAuth(creds)
+	if auth == nil {
+		return errors.New("credentials command returned no credentials")
+	}
+	return auth.Authenticate(req)
+}
+
+// context returns the context of a command. It is canceled on SIGINT or
+// SIGTERM, canceling the in-flight requests, and once total-timeout passes.
+func (s connectionSettings) context() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if s.totalTimeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, s.totalTimeout)
+		cancelParent := cancel
+		cancel = func() { cancelTimeout(); cancelParent() }
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case sig := <-signals:
+			log.Warnf("received %s, canceling", sig)
+			cancel()
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				log.Errorf("total-timeout of %s exceeded, canceling", s.totalTimeout)
+			}
+		}
+	}()
+	return ctx, cancel
+}
+
+// connect returns an ES client connected to the configured host. With
+// wait-timeout set, connection attempts failing with a transient error are
+// retried with exponential backoff and the cluster health is awaited before
+// returning; errWaitTimeout is returned if the cluster did not become ready in
+// time, including the requests and their retries. Other errors are returned
+// right away.
+func (s connectionSettings) connect(ctx context.Context) (*es.Client, error) {
+	if s.vault.SecretPath != "" {
+		if err := s.readVault(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if s.credCmd != nil {
+		// fail early, the credentials are cached for the requests
+		if _, err := s.credCmd.Get(ctx); err != nil {
+			return nil, fmt.Errorf("unable to retrieve credentials: %w", err)
+		}
+	}
+	log.Debugf("trying to connect to host: %s", s.host)
+	hosts := es.ParseHosts(s.host)
+	if len(hosts) == 0 {
+		return nil, errors.New("no ES host provided")
+	}
+	var useTLS bool
+	for _, host := range hosts {
+		u, err := url.Parse(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ES host provided %q: %w", host, err)
+		}
+		useTLS = useTLS || u.Scheme == "https"
+	}
+	httpClient := &http.Client{}
+	if useTLS {
+		tlsCfg, err := es.NewTLSConfig(s.tls)
+		if err != nil {
+			return nil, err
+		}
+		httpClient.Transport = &http.Transport{TLSClientConfig: tlsCfg}
+	}
+	deadline := time.Now().Add(s.waitTimeout)
+	if s.waitTimeout > 0 {
+		// bound the requests and their retries by the wait too
+		waitCtx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+		client, err := s.waitForCluster(waitCtx, httpClient, hosts, deadline)
+		if err != nil && waitCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			return nil, fmt.Errorf("%w: %v", errWaitTimeout, err)
+		}
+		return client, err
+	}
+	return s.waitForCluster(ctx, httpClient, hosts, deadline)
+}
+
+// waitForCluster returns an ES client once the cluster is reachable and its
+// health reached wait-for-status, see connect.
+func (s connectionSettings) waitForCluster(ctx context.Context, httpClient *http.Client, hosts []string, deadline time.Time) (*es.Client, error) {
+	backoff := minWaitBackoff
+	var (
+		client *es.Client
+		err    error
+	)
+	for {
+		client, err = es.New(ctx, httpClient, es.Config{
+			Hosts:          hosts,
+			Sniff:          s.sniff,
+			Auth:           s.auth(),
+			Retry:          s.retry,
+			RequestTimeout: s.requestTimeout,
+		})
+		if err == nil {
+			break
+		}
+		// only an unreachable or starting cluster is waited for, e.g. bad
+		// credentials fail right away
+		if s.waitTimeout <= 0 || ctx.Err() != nil || !es.IsTransient(err) {
+			return nil, fmt.Errorf("unable to create ES client: %w", err)
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("%w: %v", errWaitTimeout, err)
+		}
+		if backoff > remaining {
+			backoff = remaining
+		}
+		log.Infof("cluster not reachable, retrying in %s: %v", backoff, err)
+		if err = es.Sleep(ctx, backoff); err != nil {
+			return nil, err
+		}
+		if backoff *= 2; backoff > maxWaitBackoff {
+			backoff = maxWaitBackoff
+		}
+	}
+	log.Infof("connected to %s", client.Version())
+
+	if s.waitForStatus != "" {
+		maxWait := maxWaitBackoff
+		if s.requestTimeout > 0 && s.requestTimeout/2 < maxWait {
+			// the cluster has to answer before the request times out
+			maxWait = s.requestTimeout / 2
+		}
+		if err = waitForStatus(ctx, client, s.waitForStatus, deadline, maxWait); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// readVault retrieves the credentials from Vault, using the credential
+// settings as extraction templates. The lease of dynamic credentials, and the
+// token of the Kubernetes login holding it, are renewed in the background until
+// the context is done.
+func (s *connectionSettings) readVault(ctx context.Context) error {
+	v, err := credentials.NewVault(ctx, s.vault)
+	if err != nil {
+		return err
+	}
+	creds, lease, err := v.Read(ctx, credentials.Templates{
+		Username:    s.user,
+		Password:    s.pass,
+		APIKey:      s.apiKey,
+		BearerToken: s.bearerToken,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve credentials: %w", err)
+	}
+	s.user, s.pass = creds.Username, creds.Password
+	s.apiKey, s.bearerToken = creds.APIKey, creds.BearerToken
+	if lease != nil && lease.Renewable {
+		log.Debugf("renewing lease %s every %s", lease.ID, lease.Duration*2/3)
+		go func() {
+			if err := v.KeepAlive(ctx, *lease); err != nil && ctx.Err() == nil {
+				log.Warnf("credentials will expire: %v", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// waitForStatus waits until the cluster health reaches the status or the
+// deadline passes. The wait itself happens in the cluster, up to maxWait per
+// request, transient errors are retried with exponential backoff.
+func waitForStatus(ctx context.Context, client *es.Client, status string, deadline time.Time, maxWait time.Duration) error {
+	backoff := minWaitBackoff
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("%w: cluster health not %s", errWaitTimeout, status)
+		}
+		wait := remaining
+		if wait > maxWait {
+			wait = maxWait
+		}
+		health, err := client.WaitForStatus(ctx, status, wait)
+		switch {
+		case err != nil && (ctx.Err() != nil || !es.IsTransient(err)):
+			return err
+		case err != nil:
+			if backoff > remaining {
+				backoff = remaining
+			}
+			log.Infof("unable to get cluster health, retrying in %s: %v", backoff, err)
+			if err = es.Sleep(ctx, backoff); err != nil {
+				return err
+			}
+			if backoff *= 2; backoff > maxWaitBackoff {
+				backoff = maxWaitBackoff
+			}
+		case health.TimedOut:
+			log.Infof("cluster health is %s, waiting for %s", health.Status, status)
+		default:
+			log.Infof("cluster health is %s", health.Status)
+			return nil
+		}
+	}
+}
+
+// exitCode returns the exit code for a failed connect.
+func exitCode(err error) int {
+	if errors.Is(err, errWaitTimeout) {
+		return exitWaitTimeout
+	}
+	return 1
+}
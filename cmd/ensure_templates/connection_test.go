@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
+)
+
+func TestConnectWait(tt *testing.T) {
+	for _, item := range []struct {
+		name         string
+		statuses     []int // of the consecutive attempts, 200 afterwards
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"starting", []int{503}, 2, false},
+		{"bad credentials", []int{401}, 1, true},
+		{"missing privileges", []int{403}, 1, true},
+	} {
+		var attempts int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if attempts <= len(item.statuses) {
+				w.WriteHeader(item.statuses[attempts-1])
+				_, _ = w.Write([]byte(`{"error":{"type":"security_exception","reason":"failed"}}`))
+				return
+			}
+			_, _ = w.Write([]byte(elasticsearch710))
+		}))
+
+		s := defaultConnectionSettings()
+		s.host = srv.URL
+		s.retry = es.RetryPolicy{MaxAttempts: 1}
+		s.waitTimeout = time.Minute
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := s.connect(ctx)
+		cancel()
+		srv.Close()
+
+		if (err != nil) != item.wantErr {
+			tt.Errorf("%s: want error: %v, got: %v", item.name, item.wantErr, err)
+		}
+		if attempts != item.wantAttempts {
+			tt.Errorf("%s: want %d attempts, got: %d", item.name, item.wantAttempts, attempts)
+		}
+		// errors other than the wait timing out are config errors
+		if err != nil && (errors.Is(err, errWaitTimeout) || exitCode(err) != 1) {
+			tt.Errorf("%s: want exit code 1, got: %d (%v)", item.name, exitCode(err), err)
+		}
+	}
+}
+
+func TestResolveCloudID(tt *testing.T) {
+	const cloudID = "zipkin:dXMtZWFzdC0xLmF3cy5mb3VuZC5pbyRjZWM2ZjI2MWE3NGJmMjRjZTMzYmI4ODExYjg0Mjk0ZiRjNmMyY2E2ZDA0MjI0OWFmMGNjN2Q3YTllOTYyNTc0Mw=="
+
+	for _, item := range []struct {
+		name     string
+		env      map[string]string
+		args     []string
+		wantHost string
+		wantErr  bool
+	}{
+		{name: "cloud id", wantHost: "https://cec6f261a74bf24ce33bb8811b84294f.us-east-1.aws.found.io"},
+		{name: "host flag", args: []string{"--host", "http://es:9200"}, wantErr: true},
+		// the default host is a mistake too when set explicitly
+		{name: "default host flag", args: []string{"--host", "http://localhost:9200"}, wantErr: true},
+		{name: "ES_HOST", env: map[string]string{"ES_HOST": "http://localhost:9200"}, wantErr: true},
+		{name: "ES_HOSTS", env: map[string]string{"ES_HOSTS": "http://es-0:9200,http://es-1:9200"}, wantErr: true},
+	} {
+		tt.Run(item.name, func(tt *testing.T) {
+			for _, key := range []string{"ES_HOST", "ES_HOSTS"} {
+				tt.Setenv(key, item.env[key])
+			}
+			tt.Setenv("ES_CLOUD_ID", cloudID)
+
+			s := defaultConnectionSettings()
+			s.loadEnv()
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			s.attachToFlagSet(fs)
+			if err := fs.Parse(item.args); err != nil {
+				tt.Fatalf("unable to parse flags: %v", err)
+			}
+			err := s.resolve()
+			if (err != nil) != item.wantErr {
+				tt.Errorf("want error: %v, got: %v", item.wantErr, err)
+			}
+			if err == nil && s.host != item.wantHost {
+				tt.Errorf("want host %q, got: %q", item.wantHost, s.host)
+			}
+		})
+	}
+}
+
+func TestConnectWaitTimeout(tt *testing.T) {
+	// a cluster hanging on requests, retried by the client and with a request
+	// timeout both longer than the wait
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	s := defaultConnectionSettings()
+	s.host = srv.URL
+	s.waitTimeout = 200 * time.Millisecond
+	start := time.Now()
+	_, err := s.connect(context.Background())
+	if !errors.Is(err, errWaitTimeout) {
+		tt.Errorf("want wait timeout error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		tt.Errorf("want connect to give up after the wait timeout, took: %s", elapsed)
+	}
+}
+
+func TestResolveCredentialsDir(tt *testing.T) {
+	dir, err := ioutil.TempDir("", "es-templater")
+	if err != nil {
+		tt.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for name, value := range map[string]string{"username": "zipkin", "password": "from-dir"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0600); err != nil {
+			tt.Fatalf("unable to write %s: %v", name, err)
+		}
+	}
+
+	// explicit flags take precedence over the directory, which takes
+	// precedence over the environment
+	s := defaultConnectionSettings()
+	s.credDir = dir
+	s.user = "from-env"
+	s.flagPass = "from-flag"
+	if err = s.resolve(); err != nil {
+		tt.Fatalf("unable to resolve: %v", err)
+	}
+	if s.user != "zipkin" || s.pass != "from-flag" {
+		tt.Errorf("want zipkin:from-flag, got: %s:%s", s.user, s.pass)
+	}
+}
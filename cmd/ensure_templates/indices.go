@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
+)
+
+// number of indices deleted per request, keeps the request URL short
+const deleteBatchSize = 50
+
+// deleteIndices deletes the provided indices in batches and logs the result per
+// index. A failing batch is retried index by index to find the failing ones.
+// It returns an error if any index could not be deleted.
+func deleteIndices(ctx context.Context, client *es.Client, indices []string) (string, error) {
+	var deleted, failed int
+	for start := 0; start < len(indices); start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(indices) {
+			end = len(indices)
+		}
+		batch := indices[start:end]
+		if err := client.DeleteIndices(ctx, batch); err == nil {
+			for _, index := range batch {
+				log.Infof("deleted index %q", index)
+			}
+			deleted += len(batch)
+			continue
+		}
+		for _, index := range batch {
+			err := client.DeleteIndices(ctx, []string{index})
+			if es.IsErrorType(err, "index_not_found_exception") {
+				log.Infof("index %q already deleted", index)
+				continue
+			}
+			if err != nil {
+				log.Errorf("unable to delete index %q: %v", index, err)
+				failed++
+				continue
+			}
+			log.Infof("deleted index %q", index)
+			deleted++
+		}
+	}
+	if failed > 0 {
+		return "", fmt.Errorf("%d of %d indices not deleted", failed, len(indices))
+	}
+	return fmt.Sprintf("%d indices deleted", deleted), nil
+}
+
+// confirm asks the question on out and returns true if the answer read from in
+// is yes. It returns false without waiting for the answer once ctx is done.
+func confirm(ctx context.Context, question string, in io.Reader, out io.Writer) bool {
+	fmt.Fprintf(out, "%s [y/N]: ", question)
+	answers := make(chan string, 1)
+	go func() {
+		answer, _ := bufio.NewReader(in).ReadString('\n')
+		answers <- answer
+	}()
+	select {
+	case answer := <-answers:
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	case <-ctx.Done():
+		fmt.Fprintln(out)
+		return false
+	}
+}
+
+// formatBytes returns a human readable size.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	t "github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+const (
+	blockedError  = `{"error":{"type":"cluster_block_exception","reason":"index [%s] blocked by: [FORBIDDEN/8/index write (api)];"},"status":403}`
+	notFoundError = `{"error":{"type":"index_not_found_exception","reason":"no such index [%s]","index":"%[1]s"},"status":404}`
+)
+
+// deleteHandler fakes index deletion. Requests including a blocked index fail
+// with a cluster block, requests including a missing index fail as not found.
+func deleteHandler(tt *testing.T, blocked, missing string, deletes *[]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			tt.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		indices := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), ",")
+		*deletes = append(*deletes, r.URL.Path)
+		for _, index := range indices {
+			switch index {
+			case blocked:
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprintf(w, blockedError, index)
+				return
+			case missing:
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprintf(w, notFoundError, index)
+				return
+			}
+		}
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	}
+}
+
+func TestDeleteIndices(tt *testing.T) {
+	var indices []string
+	for i := 0; i < 120; i++ {
+		indices = append(indices, fmt.Sprintf("zipkin-span-%03d", i))
+	}
+
+	for _, item := range []struct {
+		name        string
+		blocked     string
+		missing     string
+		wantDeletes int // requests
+		wantErr     string
+		want        string
+	}{
+		{"all batches succeed", "", "", 3, "", "120 indices deleted"},
+		{"one index blocked", "zipkin-span-070", "", 3 + 50, "1 of 120 indices not deleted", ""},
+		{"one index already deleted", "", "zipkin-span-110", 3 + 20, "", "119 indices deleted"},
+	} {
+		var deletes []string
+		client := newTestClient(tt, elasticsearch710, deleteHandler(tt, item.blocked, item.missing, &deletes))
+
+		got, err := deleteIndices(context.Background(), client, indices)
+		if item.wantErr != "" {
+			if err == nil || err.Error() != item.wantErr {
+				tt.Errorf("%s: want error %q, got: %v", item.name, item.wantErr, err)
+			}
+		} else if err != nil {
+			tt.Errorf("%s: unexpected error: %v", item.name, err)
+		}
+		if got != item.want {
+			tt.Errorf("%s: want %q, got: %q", item.name, item.want, got)
+		}
+		if len(deletes) != item.wantDeletes {
+			tt.Errorf("%s: want %d delete requests, got %d: %v", item.name, item.wantDeletes, len(deletes), deletes)
+		}
+		// failing batches are retried index by index, the others are not
+		var batches []int
+		for _, path := range deletes {
+			if n := len(strings.Split(path, ",")); n > 1 {
+				batches = append(batches, n)
+			}
+		}
+		if want := []int{50, 50, 20}; !reflect.DeepEqual(batches, want) {
+			tt.Errorf("%s: want batches of %v indices, got: %v", item.name, want, batches)
+		}
+	}
+}
+
+func TestPlanPurge(tt *testing.T) {
+	tplSvc, err := t.New(t.DefaultConfig(), t.ElasticsearchVersion(7, 10))
+	if err != nil {
+		tt.Fatalf("unable to create service: %v", err)
+	}
+
+	for _, item := range []struct {
+		name    string
+		blocked string
+		missing string
+		wantErr string
+	}{
+		// an index deleted since the plan was made, e.g. by ILM, is not a failure
+		{"index already deleted", "", "zipkin-span-2026-10-15", ""},
+		// the command exits non-zero on the error of the plan
+		{"index blocked", "zipkin-span-2026-10-15", "",
+			"unable to delete Zipkin data: 1 of 3 indices not deleted"},
+	} {
+		var deletes []string
+		remove := deleteHandler(tt, item.blocked, item.missing, &deletes)
+		client := newTestClient(tt, elasticsearch710, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "GET" && r.URL.Path == "/_cat/indices/zipkin-*" {
+				_, _ = w.Write([]byte(`[
+  {"index":"zipkin-dependency-2026-10-15","docs.count":"10","store.size":"2048"},
+  {"index":"zipkin-span-2026-10-15","docs.count":"100","store.size":"4096"},
+  {"index":"zipkin-span-2026-10-16","docs.count":"50","store.size":"2048"}
+]`))
+				return
+			}
+			remove(w, r)
+		})
+
+		p, err := planPurge(context.Background(), client, tplSvc)
+		if err != nil {
+			tt.Fatalf("%s: unable to plan: %v", item.name, err)
+		}
+		if len(p) != 1 || p[0].kind != actionDelete || p[0].confirm != "delete 3 Zipkin indices (8.0 KiB)?" {
+			tt.Fatalf("%s: want a single confirmed delete of 3 indices, got: %+v", item.name, p)
+		}
+
+		err = p.apply()
+		if item.wantErr != "" {
+			if err == nil || err.Error() != item.wantErr {
+				tt.Errorf("%s: want error %q, got: %v", item.name, item.wantErr, err)
+			}
+		} else if err != nil {
+			tt.Errorf("%s: want purge to succeed, got: %v", item.name, err)
+		}
+		want := []string{
+			"/zipkin-dependency-2026-10-15,zipkin-span-2026-10-15,zipkin-span-2026-10-16",
+			"/zipkin-dependency-2026-10-15",
+			"/zipkin-span-2026-10-15",
+			"/zipkin-span-2026-10-16",
+		}
+		if !reflect.DeepEqual(deletes, want) {
+			tt.Errorf("%s: want delete requests: %v, got: %v", item.name, want, deletes)
+		}
+	}
+}
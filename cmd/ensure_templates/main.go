@@ -1,123 +1,105 @@
 package main
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"context"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"net/url"
 	"os"
-	"strconv"
-	"strings"
 
 	"github.com/spf13/pflag"
 	l "github.com/tetratelabs/log"
 
-	"github.com/tetratelabs/zipkin-es-templater/pkg/credentials"
 	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
 	t "github.com/tetratelabs/zipkin-es-templater/pkg/templater"
 )
 
 const (
 	templatePath = "/_template/"
+
+	// template API selection
+	templateAPIAuto       = "auto"
+	templateAPILegacy     = "legacy"
+	templateAPIComposable = "composable"
 )
 
+// the Zipkin index template types to ensure
+var templateTypes = []t.IndexTemplateType{
+	t.AutoCompleteType, t.SpanType, t.DependencyType,
+}
+
 var (
 	log     = l.RegisterScope("default", "Ensure Zipkin ES Index Templates", 0)
 	logOpts = l.DefaultOptions()
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "render":
+			render(os.Args[2:])
+			return
+		case "cleanup":
+			cleanup(os.Args[2:])
+			return
+		case "purge":
+			purge(os.Args[2:])
+			return
+		case "delete-traces":
+			deleteTraces(os.Args[2:])
+			return
+		}
+	}
+	ensure(os.Args[1:])
+}
+
+// ensure connects to the cluster and ensures the Zipkin index templates.
+func ensure(args []string) {
 	// init our defaults
 	var settings = struct {
-		t.Config
-		host                 string
-		caBundle             string
-		user                 string
-		pass                 string
-		credFile             string
-		disableStrictTraceID bool
-		disableSearch        bool
-		purgeData            bool
+		templateSettings
+		conn          connectionSettings
+		purgeData     bool
+		updateOnDrift bool
+		dryRun        bool
+		yes           bool
 	}{
-		Config:   t.DefaultConfig(),
-		host:     "http://localhost:9200",
-		caBundle: "",
-		user:     "",
-		pass:     "",
+		templateSettings: defaultTemplateSettings(),
+		conn:             defaultConnectionSettings(),
 	}
 	// os env override
 	{
-		if str := os.Getenv("INDEX_PREFIX"); str != "" {
-			settings.IndexPrefix = str
+		settings.loadEnv()
+		settings.conn.loadEnv()
+		if envEnabled("UPDATE_ON_DRIFT") {
+			settings.updateOnDrift = true
 		}
-		if str := os.Getenv("INDEX_REPLICAS"); str != "" {
-			if i, err := strconv.ParseInt(str, 10, 32); err == nil {
-				settings.IndexReplicas = int(i)
-			}
-		}
-		if str := os.Getenv("INDEX_SHARDS"); str != "" {
-			if i, err := strconv.ParseInt(str, 10, 32); err == nil {
-				settings.IndexShards = int(i)
-			}
-		}
-		if str := os.Getenv("ES_HOST"); str != "" {
-			settings.host = str
-		}
-		if str, found := os.LookupEnv("DISABLE_STRICT_TRACEID"); found {
-			str = strings.ToLower(str)
-			if str == "1" || str == "yes" || str == "on" {
-				settings.disableStrictTraceID = true
-			}
+		if envEnabled("DRY_RUN") {
+			settings.dryRun = true
 		}
-		if str, found := os.LookupEnv("DISABLE_SEARCH"); found {
-			str = strings.ToLower(str)
-			if str == "1" || str == "yes" || str == "on" {
-				settings.disableStrictTraceID = true
-			}
+		if envEnabled("ASSUME_YES") {
+			settings.yes = true
 		}
-		settings.caBundle, _ = os.LookupEnv("CA_BUNDLE")
-		settings.user, _ = os.LookupEnv("ES_USERNAME")
-		settings.pass, _ = os.LookupEnv("ES_PASSWORD")
-		settings.credFile, _ = os.LookupEnv("DB_CREDENTIALS_FILE")
 	}
 
 	// flag handling
 	{
-		var (
-			err  error
-			user string
-			pass string
-		)
-
 		fs := pflag.NewFlagSet("templater settings", pflag.ContinueOnError)
 		fs.SortFlags = false
-		fs.StringVarP(&settings.IndexPrefix, "prefix", "p",
-			settings.IndexPrefix, "index template name prefix")
-		fs.IntVarP(&settings.IndexReplicas, "replicas", "r",
-			settings.IndexReplicas, "index replica count")
-		fs.IntVarP(&settings.IndexShards, "shards", "s", settings.IndexShards,
-			"index shard count")
-		fs.BoolVar(&settings.disableStrictTraceID, "disable-strict-traceId",
-			settings.disableStrictTraceID,
-			"disable strict traceID (when migrating between 64-128bit)")
-		fs.BoolVar(&settings.disableSearch, "disable-search",
-			settings.disableSearch,
-			"disable search indexes (if not using Zipkin UI)")
-		fs.StringVarP(&settings.host, "host", "H", settings.host,
-			"Elasticsearch host URL")
+		settings.attachToFlagSet(fs)
+		fs.BoolVar(&settings.updateOnDrift, "update-on-drift", settings.updateOnDrift,
+			"overwrite existing templates which differ from the generated ones")
 		fs.BoolVar(&settings.purgeData, "purge-data", false,
 			"purge exising Zipkin data (useful if incorrectly indexed)")
-		fs.StringVar(&settings.caBundle, "ca-bundle", settings.caBundle, "ca-bundle for self signed https")
-		fs.StringVar(&user, "es-username", "", "basic auth username (or template if using credentials file)")
-		fs.StringVar(&pass, "es-password", "", "basic auth password (or template if using credentials file")
-		fs.StringVar(&settings.credFile, "es-credentials-file", settings.credFile, "supply a credentials file")
+		fs.BoolVar(&settings.dryRun, "dry-run", settings.dryRun,
+			"print the planned changes without applying them")
+		fs.BoolVarP(&settings.yes, "yes", "y", settings.yes,
+			"do not ask for confirmation before purging data")
+		settings.conn.attachToFlagSet(fs)
 
 		logOpts.AttachToFlagSet(fs)
 
 		// parse FlagSet and exit on error
-		if err = fs.Parse(os.Args[1:]); err != nil {
+		if err := fs.Parse(args); err != nil {
 			if err == pflag.ErrHelp {
 				os.Exit(0)
 			}
@@ -125,21 +107,13 @@ func main() {
 			os.Exit(1)
 		}
 
-		settings.StrictTraceID = !settings.disableStrictTraceID
-		settings.SearchEnabled = !settings.disableSearch
-		if user != "" {
-			settings.user = user
-		}
-		if pass != "" {
-			settings.pass = pass
+		if err := settings.resolve(); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
 		}
-
-		if settings.credFile != "" {
-			settings.user, settings.pass, err = credentials.ReadFile(settings.credFile, settings.user, settings.pass)
-			if err != nil {
-				fmt.Printf("unable to retrieve credentials: %+v\n", err)
-				os.Exit(1)
-			}
+		if err := settings.conn.resolve(); err != nil {
+			fmt.Printf("%+v\n", err)
+			os.Exit(1)
 		}
 	}
 
@@ -150,83 +124,242 @@ func main() {
 	}
 
 	// create ES client
-	log.Debugf("trying to connect to host: %s", settings.host)
-	url, err := url.Parse(settings.host)
+	ctx, cancel := settings.conn.context()
+	defer cancel()
+
+	client, err := settings.conn.connect(ctx)
 	if err != nil {
-		log.Errorf("invalid ES host provided %q: %+v", settings.host, err)
+		log.Errorf("%+v", err)
+		os.Exit(exitCode(err))
+	}
+
+	// create Template Service
+	tplSvc, err := t.New(settings.Config, client.Version())
+	if err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(1)
+	}
+
+	// pick the index template API, composable index templates are used when
+	// supported by the cluster unless overridden.
+	composable, err := settings.useComposable(client.SupportsComposableTemplates())
+	if err != nil {
+		log.Errorf("%v by %s", err, client.Version())
+		os.Exit(1)
+	}
+
+	if settings.retentionEnabled() && !tplSvc.SupportsLifecycle() && !tplSvc.SupportsISM() {
+		log.Warnf("retention ignored, lifecycle policies not supported by %s", client.Version())
+	}
+	policies := lifecyclePolicies
+	if tplSvc.SupportsISM() {
+		policies = ismPolicies
+	}
+	mts, err := policies(ctx, client, tplSvc)
+	if err != nil {
+		log.Errorf("%+v", err)
 		os.Exit(1)
 	}
-	httpClient := &http.Client{}
-	if url.Scheme == "https" && settings.caBundle != "" {
-		b, err := ioutil.ReadFile(settings.caBundle)
+	var tpls []managedResource
+	if composable {
+		tpls, err = composableTemplates(ctx, client, tplSvc)
+	} else {
+		tpls, err = legacyTemplates(ctx, client, tplSvc)
+	}
+	if err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(1)
+	}
+
+	// policies need to exist before the templates referencing them
+	mts = append(mts, tpls...)
+
+	// check for the Zipkin templates, insert if not found and report drift
+	p, err := planResources(mts, settings.updateOnDrift)
+	if err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(1)
+	}
+
+	if composable {
+		legacy, err := planLegacyTemplateDelete(ctx, client, tplSvc)
 		if err != nil {
-			log.Errorf("unable to load ca-bundle: %+v", err)
+			log.Errorf("%+v", err)
 			os.Exit(1)
 		}
-		pool := x509.NewCertPool()
-		if ok := pool.AppendCertsFromPEM(b); !ok {
-			log.Errorf("not a valid ca-bundle")
+		p = append(p, legacy...)
+	}
+
+	if tplSvc.SupportsISM() {
+		attach, err := planISMAttach(ctx, client, tplSvc)
+		if err != nil {
+			log.Errorf("%+v", err)
 			os.Exit(1)
 		}
-		httpClient.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{
-				RootCAs: pool,
-			},
+		p = append(p, attach...)
+	}
+
+	if settings.purgeData {
+		purge, err := planPurge(ctx, client, tplSvc)
+		if err != nil {
+			log.Errorf("%+v", err)
+			os.Exit(1)
 		}
+		p = append(p, purge...)
 	}
-	client, err := es.NewClient(httpClient, settings.host, settings.user,
-		settings.pass)
-	if err != nil {
-		log.Errorf("unable to create ES client: %+v\n", err)
-		os.Exit(1)
+
+	if settings.dryRun {
+		p.print(os.Stdout)
+		return
 	}
-	log.Infof("connected to Elasticsearch version: %g", client.Version())
 
-	// create Template Service
-	tplSvc, err := t.New(settings.Config, client.Version())
-	if err != nil {
+	if !settings.yes {
+		if err = p.confirm(ctx, os.Stdin, os.Stdout); err != nil {
+			log.Errorf("%v", err)
+			os.Exit(1)
+		}
+	}
+
+	if err = p.apply(); err != nil {
 		log.Errorf("%+v", err)
 		os.Exit(1)
 	}
+}
+
+// managedResource is an index template, component template or lifecycle policy
+// managed by this tool.
+type managedResource struct {
+	desc    string          // human readable description
+	key     string          // template name
+	want    interface{}     // generated template
+	current json.RawMessage // template served by the cluster, nil if missing
+	put     func() (string, error)
+}
+
+// lifecyclePolicies returns the Zipkin ILM policies of the index types with a
+// configured retention.
+func lifecyclePolicies(ctx context.Context, client *es.Client, tplSvc *t.Service) ([]managedResource, error) {
+	var mts []managedResource
+	for _, templateType := range templateTypes {
+		policy := tplSvc.LifecyclePolicyByType(templateType)
+		if policy == nil {
+			continue
+		}
+		key := tplSvc.LifecyclePolicyKey(templateType)
+		current, err := client.GetLifecyclePolicy(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get %s lifecycle policy: %w", templateType, err)
+		}
+		mts = append(mts, managedResource{
+			desc:    fmt.Sprintf("%s lifecycle policy", templateType),
+			key:     key,
+			want:    *policy,
+			current: current,
+			put:     func() (string, error) { return client.SetLifecyclePolicy(ctx, key, *policy) },
+		})
+	}
+	return mts, nil
+}
 
+// ismPolicies returns the Zipkin ISM policies of the index types with a
+// configured retention.
+func ismPolicies(ctx context.Context, client *es.Client, tplSvc *t.Service) ([]managedResource, error) {
+	var mts []managedResource
+	for _, templateType := range templateTypes {
+		policy := tplSvc.ISMPolicyByType(templateType)
+		if policy == nil {
+			continue
+		}
+		key := tplSvc.LifecyclePolicyKey(templateType)
+		current, err := client.GetISMPolicy(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get %s ISM policy: %w", templateType, err)
+		}
+		mts = append(mts, managedResource{
+			desc:    fmt.Sprintf("%s ISM policy", templateType),
+			key:     key,
+			want:    *policy,
+			current: current,
+			put:     func() (string, error) { return client.SetISMPolicy(ctx, key, *policy) },
+		})
+	}
+	return mts, nil
+}
+
+// legacyTemplates returns the Zipkin legacy index templates.
+func legacyTemplates(ctx context.Context, client *es.Client, tplSvc *t.Service) ([]managedResource, error) {
 	// retrieve all Zipkin index templates
-	tpls, err := client.GetTemplates(tplSvc.IndexPrefix() + "*")
+	tpls, err := client.GetTemplates(ctx, tplSvc.IndexPrefix()+"*")
 	if err != nil {
-		log.Errorf("unable to get templates: %+v", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("unable to get templates: %w", err)
 	}
 
-	// check for the Zipkin IndexTemplates and insert if not found
-	for _, templateType := range []t.IndexTemplateType{
-		t.AutoCompleteType, t.SpanType, t.DependencyType,
-	} {
+	var mts []managedResource
+	for _, templateType := range templateTypes {
 		key := tplSvc.IndexTemplateKey(templateType)
-		if _, found := tpls[key]; !found {
-			log.Infof("%s template %q missing", templateType, key)
-
-			tpl := tplSvc.TemplateByType(templateType)
-			if tpl == nil {
-				log.Warnf("%s template not supported", templateType)
-				continue
-			}
-
-			res, err := client.SetIndexTemplate(key, *tpl)
-			if err != nil {
-				log.Errorf("unable to create %s template: %+v", templateType, err)
-				os.Exit(1)
-			}
-
-			log.Infof("%s template update: %s", templateType, res)
-		} else {
-			log.Debugf("%s template found", templateType)
+		tpl := tplSvc.TemplateByType(templateType)
+		if tpl == nil {
+			log.Warnf("%s template not supported", templateType)
+			continue
 		}
+		mts = append(mts, managedResource{
+			desc:    fmt.Sprintf("%s template", templateType),
+			key:     key,
+			want:    *tpl,
+			current: tpls[key],
+			put:     func() (string, error) { return client.SetIndexTemplate(ctx, key, *tpl) },
+		})
 	}
+	return mts, nil
+}
 
-	if settings.purgeData {
-		res, err := client.DeleteIndex(tplSvc.IndexPrefix() + "*")
-		if err != nil {
-			log.Errorf("unable to delete Zipkin data: %+v", err)
+// composableTemplates returns the Zipkin composable index templates preceded by
+// the component templates they are composed of.
+func composableTemplates(ctx context.Context, client *es.Client, tplSvc *t.Service) ([]managedResource, error) {
+	// retrieve all Zipkin component and index templates
+	components, err := client.GetComponentTemplates(ctx, tplSvc.IndexPrefix()+"*")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get component templates: %w", err)
+	}
+	tpls, err := client.GetComposableIndexTemplates(ctx, tplSvc.IndexPrefix()+"*")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get index templates: %w", err)
+	}
+
+	// component templates need to exist before the index templates using them
+	key := tplSvc.SettingsComponentKey()
+	settings := tplSvc.SettingsComponentTemplate()
+	mts := []managedResource{{
+		desc:    "settings component template",
+		key:     key,
+		want:    settings,
+		current: components[key],
+		put:     func() (string, error) { return client.SetComponentTemplate(ctx, key, settings) },
+	}}
+	for _, templateType := range templateTypes {
+		componentKey := tplSvc.ComponentTemplateKey(templateType)
+		component := tplSvc.ComponentTemplateByType(templateType)
+		key := tplSvc.IndexTemplateKey(templateType)
+		tpl := tplSvc.IndexTemplateByType(templateType)
+		if component == nil || tpl == nil {
+			log.Warnf("%s template not supported", templateType)
+			continue
 		}
-		log.Infof("purge Zipkin data: %s", res)
+		mts = append(mts, managedResource{
+			desc:    fmt.Sprintf("%s component template", templateType),
+			key:     componentKey,
+			want:    *component,
+			current: components[componentKey],
+			put: func() (string, error) {
+				return client.SetComponentTemplate(ctx, componentKey, *component)
+			},
+		}, managedResource{
+			desc:    fmt.Sprintf("%s template", templateType),
+			key:     key,
+			want:    *tpl,
+			current: tpls[key],
+			put:     func() (string, error) { return client.SetComposableIndexTemplate(ctx, key, *tpl) },
+		})
 	}
+	return mts, nil
 }
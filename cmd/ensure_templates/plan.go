@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
+	t "github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+// actionKind describes what an action does to the cluster.
+type actionKind string
+
+// action kinds
+const (
+	actionCreate actionKind = "create"
+	actionUpdate actionKind = "update"
+	actionDrift  actionKind = "drift" // reported only, not updated
+	actionDelete actionKind = "delete"
+	actionAttach actionKind = "attach"
+)
+
+// errAborted is returned if a planned action was not confirmed.
+var errAborted = errors.New("aborted")
+
+// action is a single planned change to the cluster.
+type action struct {
+	kind    actionKind
+	desc    string
+	key     string
+	diffs   []t.Difference
+	details []string
+	warning string // caveat printed with the action, if any
+	confirm string // question to confirm before applying, if any
+	apply   func() (string, error)
+}
+
+// plan holds the ordered actions needed to bring the cluster in the desired
+// state. The same plan is either printed (dry-run) or applied.
+type plan []action
+
+// planResources plans the creation of missing templates and policies and the
+// update of drifted ones. If updateOnDrift is not set, drifted resources are
+// reported only.
+func planResources(mts []managedResource, updateOnDrift bool) (plan, error) {
+	var p plan
+	for _, mt := range mts {
+		if mt.current == nil {
+			p = append(p, action{
+				kind: actionCreate, desc: mt.desc, key: mt.key, apply: mt.put,
+			})
+			continue
+		}
+		diffs, err := t.Diff(mt.want, mt.current)
+		if err != nil {
+			return nil, fmt.Errorf("unable to compare %s: %w", mt.desc, err)
+		}
+		if len(diffs) == 0 {
+			log.Debugf("%s found", mt.desc)
+			continue
+		}
+		a := action{
+			kind: actionDrift, desc: mt.desc, key: mt.key, diffs: diffs,
+		}
+		if updateOnDrift {
+			a.kind = actionUpdate
+			a.apply = mt.put
+		}
+		p = append(p, a)
+	}
+	return p, nil
+}
+
+// planISMAttach plans attaching the ISM policies to existing indices which are
+// not managed by ISM yet. New indices get the policy through its ism_template.
+func planISMAttach(ctx context.Context, client *es.Client, tplSvc *t.Service) (plan, error) {
+	var p plan
+	for _, templateType := range templateTypes {
+		if tplSvc.ISMPolicyByType(templateType) == nil {
+			continue
+		}
+		key := tplSvc.LifecyclePolicyKey(templateType)
+		pattern := tplSvc.IndexPattern(templateType)
+		policies, err := client.GetISMPolicyIDs(ctx, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get %s ISM policies: %w", templateType, err)
+		}
+		var unmanaged []string
+		for index, policyID := range policies {
+			if policyID == "" {
+				unmanaged = append(unmanaged, index)
+			}
+		}
+		if len(unmanaged) == 0 {
+			continue
+		}
+		sort.Strings(unmanaged)
+		indices := strings.Join(unmanaged, ",")
+		p = append(p, action{
+			kind: actionAttach, desc: fmt.Sprintf("%s ISM policy", templateType),
+			key: key, details: unmanaged,
+			apply: func() (string, error) { return client.AddISMPolicy(ctx, indices, key) },
+		})
+	}
+	return p, nil
+}
+
+// planLegacyTemplateDelete plans the removal of the legacy Zipkin index
+// templates left behind when switching to composable index templates. They are
+// deleted after the composable templates are in place, which take precedence
+// over legacy templates matching the same indices.
+func planLegacyTemplateDelete(ctx context.Context, client *es.Client, tplSvc *t.Service) (plan, error) {
+	tpls, err := client.GetTemplates(ctx, tplSvc.IndexPrefix()+"*")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get legacy templates: %w", err)
+	}
+	var p plan
+	for _, templateType := range templateTypes {
+		key := tplSvc.IndexTemplateKey(templateType)
+		if _, ok := tpls[key]; !ok {
+			continue
+		}
+		p = append(p, action{
+			kind: actionDelete, desc: fmt.Sprintf("legacy %s template", templateType),
+			key:   key,
+			apply: func() (string, error) { return client.DeleteTemplate(ctx, key) },
+		})
+	}
+	return p, nil
+}
+
+// planPurge plans the removal of all Zipkin data. The indices are resolved
+// up front as wildcard deletes are rejected by clusters enforcing
+// action.destructive_requires_name.
+func planPurge(ctx context.Context, client *es.Client, tplSvc *t.Service) (plan, error) {
+	pattern := tplSvc.IndexPrefix() + "*"
+	indices, err := client.GetIndices(ctx, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get indices: %w", err)
+	}
+	if len(indices) == 0 {
+		log.Debugf("no Zipkin data to purge")
+		return nil, nil
+	}
+
+	var (
+		names []string
+		total int64
+	)
+	a := action{kind: actionDelete, desc: "Zipkin data", key: pattern}
+	for _, index := range indices {
+		names = append(names, index.Index)
+		total += index.SizeInBytes()
+		a.details = append(a.details, fmt.Sprintf("%s (%s docs, %s)",
+			index.Index, index.DocsCount, formatBytes(index.SizeInBytes())))
+	}
+	a.details = append(a.details, fmt.Sprintf("total: %d indices, %s",
+		len(indices), formatBytes(total)))
+	a.confirm = fmt.Sprintf("delete %d Zipkin indices (%s)?", len(indices), formatBytes(total))
+	a.apply = func() (string, error) { return deleteIndices(ctx, client, names) }
+	return plan{a}, nil
+}
+
+// print writes the plan in human readable form.
+func (p plan) print(w io.Writer) {
+	if len(p) == 0 {
+		fmt.Fprintln(w, "no changes")
+		return
+	}
+	for _, a := range p {
+		a.print(w)
+	}
+}
+
+func (a action) print(w io.Writer) {
+	fmt.Fprintf(w, "%s %s %q\n", a.kind, a.desc, a.key)
+	if a.warning != "" {
+		fmt.Fprintf(w, "    warning: %s\n", a.warning)
+	}
+	for _, diff := range a.diffs {
+		fmt.Fprintf(w, "    %s\n", diff)
+	}
+	for _, detail := range a.details {
+		fmt.Fprintf(w, "    %s\n", detail)
+	}
+}
+
+// warnings returns the warnings of the planned actions.
+func (p plan) warnings() []string {
+	var warnings []string
+	for _, a := range p {
+		if a.warning != "" {
+			warnings = append(warnings, a.warning)
+		}
+	}
+	return warnings
+}
+
+// confirm asks for confirmation of the actions requiring it. It returns
+// errAborted if an action was not confirmed and an error wrapping the context
+// error if ctx was done while waiting for an answer, e.g. on SIGINT.
+func (p plan) confirm(ctx context.Context, in io.Reader, out io.Writer) error {
+	for _, a := range p {
+		if a.confirm == "" {
+			continue
+		}
+		a.print(out)
+		if !confirm(ctx, a.confirm, in, out) {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("interrupted: %w", err)
+			}
+			return errAborted
+		}
+	}
+	return nil
+}
+
+// apply executes the planned actions in order.
+func (p plan) apply() error {
+	for _, a := range p {
+		switch a.kind {
+		case actionCreate:
+			log.Infof("%s %q missing", a.desc, a.key)
+		case actionUpdate, actionDrift:
+			for _, diff := range a.diffs {
+				log.Warnf("%s %q drifted: %s", a.desc, a.key, diff)
+			}
+		}
+		if a.apply == nil {
+			continue
+		}
+
+		res, err := a.apply()
+		if err != nil {
+			return fmt.Errorf("unable to %s %s: %w", a.kind, a.desc, err)
+		}
+		log.Infof("%s %s: %s", a.desc, a.kind, res)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
+	t "github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+// newTestClient returns a client of a fake cluster reporting the version in
+// info and serving all other requests with handler.
+func newTestClient(tb testing.TB, info string, handler http.HandlerFunc) *es.Client {
+	tb.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			_, _ = w.Write([]byte(info))
+			return
+		}
+		handler(w, r)
+	}))
+	tb.Cleanup(srv.Close)
+	cfg := es.DefaultConfig()
+	cfg.Hosts = []string{srv.URL}
+	client, err := es.New(context.Background(), srv.Client(), cfg)
+	if err != nil {
+		tb.Fatalf("unable to create client: %v", err)
+	}
+	return client
+}
+
+const openSearch211 = `{"version":{"distribution":"opensearch","number":"2.11.0"}}`
+
+// ISM policy as served by GET _plugins/_ism/policies, wrapped with the server
+// metadata
+const spanISMPolicy = `{
+  "_id": "zipkin-span_policy",
+  "_version": 1,
+  "_seq_no": 0,
+  "_primary_term": 1,
+  "policy": {
+    "policy_id": "zipkin-span_policy",
+    "description": "Zipkin span retention",
+    "last_updated_time": 1697443200000,
+    "schema_version": 19,
+    "error_notification": null,
+    "default_state": "hot",
+    "states": [
+      {"name": "hot", "actions": [], "transitions": [{"state_name": "delete", "conditions": {"min_index_age": "%s"}}]},
+      {"name": "delete", "actions": [{"retry": {"count": 3, "backoff": "exponential", "delay": "1m"}, "delete": {}}], "transitions": []}
+    ],
+    "ism_template": [{"index_patterns": ["zipkin-span-*"], "priority": 100, "last_updated_time": 1697443200000}]
+  }
+}`
+
+func TestPlanISMAttach(tt *testing.T) {
+	cfg := t.DefaultConfig()
+	cfg.SpanRetentionDays = 7
+	tplSvc, err := t.New(cfg, t.OpenSearchVersion(2, 11))
+	if err != nil {
+		tt.Fatalf("unable to create service: %v", err)
+	}
+
+	var (
+		addPath string
+		addBody map[string]string
+	)
+	client := newTestClient(tt, openSearch211, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/_plugins/_ism/explain/zipkin-span-*":
+			_, _ = w.Write([]byte(`{
+  "zipkin-span-2026-10-14": {"index.plugins.index_state_management.policy_id": "zipkin-span_policy", "index.opendistro.index_state_management.policy_id": "zipkin-span_policy"},
+  "zipkin-span-2026-10-15": {"index.plugins.index_state_management.policy_id": null},
+  "zipkin-span-2026-10-13": {"index.plugins.index_state_management.policy_id": "custom_policy"},
+  "zipkin-span-2026-10-16": {},
+  "total_managed_indices": 2
+}`))
+		case r.Method == "POST":
+			addPath = r.URL.Path
+			b, _ := ioutil.ReadAll(r.Body)
+			_ = json.Unmarshal(b, &addBody)
+			_, _ = w.Write([]byte(`{"updated_indices":2,"failures":false,"failed_indices":[]}`))
+		default:
+			tt.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+
+	p, err := planISMAttach(context.Background(), client, tplSvc)
+	if err != nil {
+		tt.Fatalf("unable to plan: %v", err)
+	}
+	if len(p) != 1 {
+		tt.Fatalf("want a single attach action, got: %+v", p)
+	}
+	a := p[0]
+	if a.kind != actionAttach || a.key != "zipkin-span_policy" {
+		tt.Errorf("want attach of zipkin-span_policy, got: %s %s", a.kind, a.key)
+	}
+	// indices managed by any policy, ours or not, are left alone
+	want := []string{"zipkin-span-2026-10-15", "zipkin-span-2026-10-16"}
+	if !reflect.DeepEqual(a.details, want) {
+		tt.Errorf("want indices: %v, got: %v", want, a.details)
+	}
+
+	if _, err = a.apply(); err != nil {
+		tt.Fatalf("unable to apply: %v", err)
+	}
+	if wantPath := "/_plugins/_ism/add/zipkin-span-2026-10-15,zipkin-span-2026-10-16"; addPath != wantPath {
+		tt.Errorf("want add to %s, got: %s", wantPath, addPath)
+	}
+	if addBody["policy_id"] != "zipkin-span_policy" {
+		tt.Errorf("want policy_id zipkin-span_policy, got: %v", addBody)
+	}
+}
+
+func TestISMPolicyDrift(tt *testing.T) {
+	cfg := t.DefaultConfig()
+	cfg.SpanRetentionDays = 7
+	tplSvc, err := t.New(cfg, t.OpenSearchVersion(2, 11))
+	if err != nil {
+		tt.Fatalf("unable to create service: %v", err)
+	}
+
+	for _, item := range []struct {
+		name      string
+		current   string // served policy, with the min_index_age of age
+		age       string
+		wantKind  actionKind
+		wantPaths []string
+	}{
+		{"missing", "", "", actionCreate, nil},
+		{"in sync", spanISMPolicy, "7d", "", nil},
+		{"retention changed", spanISMPolicy, "30d", actionDrift,
+			[]string{"policy.states.0.transitions.0.conditions.min_index_age"}},
+	} {
+		client := newTestClient(tt, openSearch211, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "GET" || r.URL.Path != "/_plugins/_ism/policies/zipkin-span_policy" {
+				tt.Errorf("%s: unexpected request: %s %s", item.name, r.Method, r.URL)
+			}
+			if item.current == "" {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error":{"type":"status_exception","reason":"Policy not found"},"status":404}`))
+				return
+			}
+			_, _ = w.Write([]byte(fmt.Sprintf(item.current, item.age)))
+		})
+
+		mts, err := ismPolicies(context.Background(), client, tplSvc)
+		if err != nil {
+			tt.Fatalf("%s: unable to get policies: %v", item.name, err)
+		}
+		p, err := planResources(mts, false)
+		if err != nil {
+			tt.Fatalf("%s: unable to plan: %v", item.name, err)
+		}
+		if item.wantKind == "" {
+			if len(p) != 0 {
+				tt.Errorf("%s: want no actions, got: %+v", item.name, p)
+			}
+			continue
+		}
+		if len(p) != 1 || p[0].kind != item.wantKind {
+			tt.Errorf("%s: want a single %s action, got: %+v", item.name, item.wantKind, p)
+			continue
+		}
+		var paths []string
+		for _, diff := range p[0].diffs {
+			paths = append(paths, diff.Path)
+		}
+		if !reflect.DeepEqual(paths, item.wantPaths) {
+			tt.Errorf("%s: want differences at %v, got: %v", item.name, item.wantPaths, p[0].diffs)
+		}
+	}
+}
+
+func TestPlanConfirm(tt *testing.T) {
+	p := plan{
+		{kind: actionCreate, desc: "index template", key: "zipkin-span_template"},
+		{kind: actionDelete, desc: "indices", key: "zipkin-span-*", confirm: "delete 3 Zipkin indices?"},
+	}
+	for _, item := range []struct {
+		name string
+		// answer is the input, nil for a prompt never answered
+		answer io.Reader
+		// cancel cancels the context while prompting
+		cancel  bool
+		wantErr error
+	}{
+		{"yes", strings.NewReader("yes\n"), false, nil},
+		{"y", strings.NewReader("Y\n"), false, nil},
+		{"no", strings.NewReader("n\n"), false, errAborted},
+		{"no answer", strings.NewReader(""), false, errAborted},
+		{"interrupted", nil, true, context.Canceled},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		in := item.answer
+		if in == nil {
+			r, w := io.Pipe()
+			defer w.Close()
+			in = r
+		}
+		if item.cancel {
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				cancel()
+			}()
+		}
+
+		var out bytes.Buffer
+		done := make(chan error, 1)
+		go func() { done <- p.confirm(ctx, in, &out) }()
+		select {
+		case err := <-done:
+			if !errors.Is(err, item.wantErr) {
+				tt.Errorf("%s: want error %v, have %v", item.name, item.wantErr, err)
+			}
+			if item.cancel && (err == nil || !strings.HasPrefix(err.Error(), "interrupted")) {
+				tt.Errorf("%s: want interrupted error, have %v", item.name, err)
+			}
+		case <-time.After(5 * time.Second):
+			tt.Fatalf("%s: confirmation not returning", item.name)
+		}
+		if !strings.Contains(out.String(), "delete 3 Zipkin indices? [y/N]: ") {
+			tt.Errorf("%s: want the question, have %q", item.name, out.String())
+		}
+		cancel()
+	}
+}
+
+func TestPlanLegacyTemplateDelete(tt *testing.T) {
+	tplSvc, err := t.New(t.DefaultConfig(), t.ElasticsearchVersion(7, 10))
+	if err != nil {
+		tt.Fatalf("unable to create service: %v", err)
+	}
+	var deleted []string
+	client := newTestClient(tt, elasticsearch710, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/_template/zipkin-*":
+			// legacy Zipkin templates next to a custom one sharing the prefix
+			_, _ = w.Write([]byte(`{
+				"zipkin-span_template": {"index_patterns": ["zipkin-span-*"]},
+				"zipkin-dependency_template": {"index_patterns": ["zipkin-dependency-*"]},
+				"zipkin-custom_template": {"index_patterns": ["zipkin-custom-*"]}
+			}`))
+		case r.Method == "DELETE":
+			deleted = append(deleted, r.URL.Path)
+			_, _ = w.Write([]byte(`{"acknowledged":true}`))
+		default:
+			tt.Errorf("unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	p, err := planLegacyTemplateDelete(context.Background(), client, tplSvc)
+	if err != nil {
+		tt.Fatalf("unexpected error: %v", err)
+	}
+	var out bytes.Buffer
+	p.print(&out)
+	want := "delete legacy span template \"zipkin-span_template\"\n" +
+		"delete legacy dependency template \"zipkin-dependency_template\"\n"
+	if out.String() != want {
+		tt.Errorf("want plan:\n%s\nhave:\n%s", want, out.String())
+	}
+	if len(deleted) > 0 {
+		tt.Errorf("deleted while planning: %v", deleted)
+	}
+
+	if err = p.apply(); err != nil {
+		tt.Fatalf("unexpected error: %v", err)
+	}
+	wantDeleted := []string{"/_template/zipkin-span_template", "/_template/zipkin-dependency_template"}
+	if !reflect.DeepEqual(deleted, wantDeleted) {
+		tt.Errorf("want deleted %v, have %v", wantDeleted, deleted)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+	l "github.com/tetratelabs/log"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
+	t "github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+// purge deletes the spans matching the provided filters, e.g. to remove
+// sensitive data of a single service or time window without deleting the
+// daily indices holding it.
+func purge(args []string) {
+	// init our defaults
+	var settings = struct {
+		templateSettings
+		conn         connectionSettings
+		filter       t.SpanFilter
+		start        string
+		end          string
+		pollInterval time.Duration
+		dryRun       bool
+		yes          bool
+	}{
+		templateSettings: defaultTemplateSettings(),
+		conn:             defaultConnectionSettings(),
+		pollInterval:     5 * time.Second,
+	}
+	// os env override
+	{
+		settings.loadEnv()
+		settings.conn.loadEnv()
+		if envEnabled("DRY_RUN") {
+			settings.dryRun = true
+		}
+		if envEnabled("ASSUME_YES") {
+			settings.yes = true
+		}
+	}
+
+	// flag handling
+	{
+		fs := pflag.NewFlagSet("purge settings", pflag.ContinueOnError)
+		fs.SortFlags = false
+		fs.StringVarP(&settings.IndexPrefix, "prefix", "p",
+			settings.IndexPrefix, "index name prefix")
+		fs.BoolVar(&settings.disableSearch, "disable-search", settings.disableSearch,
+			"search indexes are disabled (filters are not available)")
+		fs.StringVar(&settings.filter.ServiceName, "service", "",
+			"delete spans of the local service name")
+		fs.StringVar(&settings.filter.SpanName, "span-name", "",
+			"delete spans with the name")
+		fs.StringArrayVar(&settings.filter.Tags, "tag", nil,
+			"delete spans with the tag, as key or key=value (repeatable)")
+		fs.StringVar(&settings.start, "start", "",
+			"delete spans starting at or after the time (RFC 3339 or YYYY-MM-DD in UTC)")
+		fs.StringVar(&settings.end, "end", "",
+			"delete spans starting before the time (RFC 3339 or YYYY-MM-DD in UTC)")
+		fs.DurationVar(&settings.pollInterval, "poll-interval", settings.pollInterval,
+			"interval between delete task progress reports")
+		fs.BoolVar(&settings.dryRun, "dry-run", settings.dryRun,
+			"print the number of matching spans without deleting them")
+		fs.BoolVarP(&settings.yes, "yes", "y", settings.yes,
+			"do not ask for confirmation before deleting spans")
+		settings.conn.attachToFlagSet(fs)
+
+		logOpts.AttachToFlagSet(fs)
+
+		// parse FlagSet and exit on error
+		if err := fs.Parse(args); err != nil {
+			if err == pflag.ErrHelp {
+				os.Exit(0)
+			}
+			fmt.Printf("unable to parse settings: %+v\n", err)
+			os.Exit(1)
+		}
+
+		var err error
+		if settings.filter.Start, err = parseTime(settings.start); err != nil {
+			fmt.Printf("invalid start: %v\n", err)
+			os.Exit(1)
+		}
+		if settings.filter.End, err = parseTime(settings.end); err != nil {
+			fmt.Printf("invalid end: %v\n", err)
+			os.Exit(1)
+		}
+		if settings.filter.IsEmpty() {
+			fmt.Println("no span filter provided, use --purge-data to delete all data")
+			os.Exit(1)
+		}
+		if settings.pollInterval <= 0 {
+			fmt.Printf("invalid poll-interval: %s\n", settings.pollInterval)
+			os.Exit(1)
+		}
+		if err := settings.resolve(); err != nil {
+			fmt.Printf("%+v\n", err)
+			os.Exit(1)
+		}
+		if err := settings.conn.resolve(); err != nil {
+			fmt.Printf("%+v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// initialize the logging subsystem
+	if err := l.Configure(logOpts); err != nil {
+		fmt.Printf("failed to configure logging: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := settings.conn.context()
+	defer cancel()
+
+	client, err := settings.conn.connect(ctx)
+	if err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(exitCode(err))
+	}
+	tplSvc, err := t.New(settings.Config, client.Version())
+	if err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(1)
+	}
+
+	p, err := planSpanPurge(ctx, client, tplSvc, settings.filter, settings.pollInterval)
+	if err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(1)
+	}
+	if settings.dryRun {
+		p.print(os.Stdout)
+		return
+	}
+	if !settings.yes {
+		if err = p.confirm(ctx, os.Stdin, os.Stdout); err != nil {
+			log.Errorf("%v", err)
+			os.Exit(1)
+		}
+	}
+	if err = p.apply(); err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(1)
+	}
+}
+
+// planSpanPurge plans the deletion of the spans matching the filter. The
+// matching spans are counted up front so the plan shows what is deleted.
+func planSpanPurge(ctx context.Context, client *es.Client, tplSvc *t.Service, filter t.SpanFilter, pollInterval time.Duration) (plan, error) {
+	query, err := tplSvc.SpanQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+	pattern := tplSvc.IndexPattern(t.SpanType)
+	count, err := client.CountDocuments(ctx, pattern, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to count spans: %w", err)
+	}
+	if count == 0 {
+		log.Infof("no spans match the filter")
+		return nil, nil
+	}
+	q, err := query.Serialize(false)
+	if err != nil {
+		return nil, err
+	}
+	return plan{{
+		kind:    actionDelete,
+		desc:    "spans",
+		key:     pattern,
+		details: []string{q, fmt.Sprintf("%d matching spans", count)},
+		confirm: fmt.Sprintf("delete %d spans?", count),
+		apply: func() (string, error) {
+			deleted, err := deleteByQuery(ctx, client, pattern, query, pollInterval)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d spans deleted", deleted), nil
+		},
+	}}, nil
+}
+
+// deleteByQuery runs a delete by query task and reports its progress until it
+// completes. It returns the number of deleted documents.
+func deleteByQuery(ctx context.Context, client *es.Client, pattern string, query *t.Query, pollInterval time.Duration) (int64, error) {
+	taskID, err := client.DeleteByQuery(ctx, pattern, query)
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("started delete task %s", taskID)
+	for {
+		if err := es.Sleep(ctx, pollInterval); err != nil {
+			return 0, err
+		}
+		task, err := client.GetTask(ctx, taskID)
+		if err != nil {
+			return 0, fmt.Errorf("unable to get task %s: %w", taskID, err)
+		}
+		status := task.Task.Status
+		if !task.Completed {
+			log.Infof("deleted %d of %d spans (%d batches)",
+				status.Deleted, status.Total, status.Batches)
+			continue
+		}
+		if len(task.Error) > 0 {
+			return 0, errors.New(string(task.Error))
+		}
+		if task.Response != nil && len(task.Response.Failures) > 0 {
+			for _, failure := range task.Response.Failures {
+				log.Errorf("delete failure: %s", failure)
+			}
+			return 0, fmt.Errorf("%d failures deleting spans, %d deleted",
+				len(task.Response.Failures), task.Response.Deleted)
+		}
+		if status.VersionConflicts > 0 {
+			log.Warnf("%d spans changed while deleting, run again to delete them",
+				status.VersionConflicts)
+		}
+		return status.Deleted, nil
+	}
+}
+
+// parseTime parses an RFC 3339 time or a date in UTC. An empty string returns
+// the zero time.
+func parseTime(str string) (time.Time, error) {
+	if str == "" {
+		return time.Time{}, nil
+	}
+	if ts, err := time.Parse(time.RFC3339, str); err == nil {
+		return ts, nil
+	}
+	return time.Parse("2006-01-02", str)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	t "github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+func TestPlanSpanPurge(tt *testing.T) {
+	const running = `{"completed":false,"task":{"status":{"total":30,"deleted":10,"batches":1}}}`
+	for _, item := range []struct {
+		name string
+		// tasks holds the responses to the task polls in order
+		tasks []string
+		// cancel cancels the context while polling the task
+		cancel  bool
+		want    string
+		wantErr string
+	}{
+		{"completed", []string{
+			running,
+			`{"completed":true,"task":{"status":{"total":30,"deleted":30,"batches":3}},"response":{"deleted":30,"failures":[]}}`,
+		}, false, "30 spans deleted", ""},
+		{"version conflicts", []string{
+			`{"completed":true,"task":{"status":{"total":30,"deleted":28,"batches":3,"version_conflicts":2}},"response":{"deleted":28,"failures":[]}}`,
+		}, false, "28 spans deleted", ""},
+		{"failures", []string{
+			running,
+			`{"completed":true,"task":{"status":{"total":30,"deleted":20,"batches":3}},"response":{"deleted":20,"failures":[{"index":"zipkin-span-2026-10-16","cause":{"type":"es_rejected_execution_exception"}},{"index":"zipkin-span-2026-10-16","cause":{"type":"es_rejected_execution_exception"}}]}}`,
+		}, false, "", "2 failures deleting spans, 20 deleted"},
+		{"task error", []string{
+			`{"completed":true,"task":{"status":{"total":30}},"error":{"type":"search_phase_execution_exception"}}`,
+		}, false, "", "search_phase_execution_exception"},
+		{"canceled", []string{running, running}, true, "", context.Canceled.Error()},
+	} {
+		tplSvc, err := t.New(t.DefaultConfig(), t.ElasticsearchVersion(7, 10))
+		if err != nil {
+			tt.Fatalf("unable to create service: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var polls int
+		client := newTestClient(tt, elasticsearch710, func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "POST" && r.URL.Path == "/zipkin-span-*/_count":
+				_, _ = w.Write([]byte(`{"count":30}`))
+			case r.Method == "POST" && r.URL.Path == "/zipkin-span-*/_delete_by_query":
+				if r.URL.Query().Get("wait_for_completion") != "false" {
+					tt.Errorf("%s: delete by query waits for completion", item.name)
+				}
+				_, _ = w.Write([]byte(`{"task":"node:42"}`))
+			case r.Method == "GET" && r.URL.Path == "/_tasks/node:42":
+				if polls >= len(item.tasks) {
+					tt.Errorf("%s: unexpected task poll %d", item.name, polls+1)
+					polls = len(item.tasks) - 1
+				}
+				_, _ = w.Write([]byte(item.tasks[polls]))
+				polls++
+				if item.cancel {
+					cancel()
+				}
+			default:
+				tt.Errorf("%s: unexpected request: %s %s", item.name, r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+
+		filter := t.SpanFilter{ServiceName: "frontend"}
+		p, err := planSpanPurge(ctx, client, tplSvc, filter, time.Millisecond)
+		if err != nil {
+			tt.Fatalf("%s: unexpected error: %v", item.name, err)
+		}
+		if len(p) != 1 {
+			tt.Fatalf("%s: want 1 action, have %d", item.name, len(p))
+		}
+		if want := "30 matching spans"; p[0].details[1] != want {
+			tt.Errorf("%s: details: want %q, have %q", item.name, want, p[0].details[1])
+		}
+
+		have, err := p[0].apply()
+		switch {
+		case item.wantErr == "" && err != nil:
+			tt.Errorf("%s: unexpected error: %v", item.name, err)
+		case item.wantErr != "" && (err == nil || !strings.Contains(err.Error(), item.wantErr)):
+			tt.Errorf("%s: want error %q, have %v", item.name, item.wantErr, err)
+		case have != item.want:
+			tt.Errorf("%s: want %q, have %q", item.name, item.want, have)
+		}
+		if item.cancel {
+			if !errors.Is(err, context.Canceled) {
+				tt.Errorf("%s: want context.Canceled, have %v", item.name, err)
+			}
+			if polls != 1 {
+				tt.Errorf("%s: want polling to stop after 1 poll, have %d", item.name, polls)
+			}
+		} else if polls != len(item.tasks) {
+			tt.Errorf("%s: want %d task polls, have %d", item.name, len(item.tasks), polls)
+		}
+		cancel()
+	}
+}
+
+func TestPlanSpanPurgeNoMatches(tt *testing.T) {
+	tplSvc, err := t.New(t.DefaultConfig(), t.ElasticsearchVersion(7, 10))
+	if err != nil {
+		tt.Fatalf("unable to create service: %v", err)
+	}
+	client := newTestClient(tt, elasticsearch710, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/zipkin-span-*/_count" {
+			tt.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		}
+		_, _ = w.Write([]byte(`{"count":0}`))
+	})
+	p, err := planSpanPurge(context.Background(), client, tplSvc,
+		t.SpanFilter{ServiceName: "frontend"}, time.Millisecond)
+	if err != nil {
+		tt.Fatalf("unexpected error: %v", err)
+	}
+	if len(p) != 0 {
+		tt.Errorf("want empty plan, have %d actions", len(p))
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+
+	t "github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+// render output formats
+const (
+	formatJSON      = "json"
+	formatYAML      = "yaml"
+	formatConfigMap = "configmap"
+)
+
+// serializer is implemented by all generated template types.
+type serializer interface {
+	Serialize(pretty bool) (string, error)
+}
+
+// renderedTemplate is a named template to render.
+type renderedTemplate struct {
+	name string
+	tpl  serializer
+}
+
+// configMap is a Kubernetes ConfigMap holding the rendered templates.
+type configMap struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Data map[string]string `yaml:"data"`
+}
+
+// render generates the Zipkin templates for the provided version without
+// connecting to a cluster and writes them to stdout or an output directory.
+func render(args []string) {
+	// init our defaults
+	var settings = struct {
+		templateSettings
+		version       string
+		distribution  string
+		types         []string
+		format        string
+		outputDir     string
+		configMapName string
+	}{
+		templateSettings: defaultTemplateSettings(),
+		version:          "7.10",
+		distribution:     string(t.Elasticsearch),
+		format:           formatJSON,
+	}
+	// os env override
+	settings.loadEnv()
+
+	// flag handling
+	{
+		fs := pflag.NewFlagSet("render settings", pflag.ContinueOnError)
+		fs.SortFlags = false
+		settings.attachToFlagSet(fs)
+		fs.StringVar(&settings.version, "es-version", settings.version,
+			"version to render the templates for (major.minor)")
+		fs.StringVar(&settings.distribution, "distribution", settings.distribution,
+			"distribution to render the templates for, one of [elasticsearch, opensearch]")
+		fs.StringSliceVar(&settings.types, "type", settings.types,
+			"template types to render, any of [autocomplete, span, dependency] (default all)")
+		fs.StringVarP(&settings.format, "format", "f", settings.format,
+			"output format, one of [json, yaml, configmap]")
+		fs.StringVarP(&settings.outputDir, "output-dir", "o", settings.outputDir,
+			"directory to write the templates to (default stdout)")
+		fs.StringVar(&settings.configMapName, "configmap-name", settings.configMapName,
+			"name of the rendered ConfigMap (default <prefix>-templates)")
+
+		// parse FlagSet and exit on error
+		if err := fs.Parse(args); err != nil {
+			if err == pflag.ErrHelp {
+				os.Exit(0)
+			}
+			fmt.Printf("unable to parse settings: %+v\n", err)
+			os.Exit(1)
+		}
+		if err := settings.resolve(); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		switch settings.format {
+		case formatJSON, formatYAML, formatConfigMap:
+		default:
+			fmt.Printf("invalid format: %q\n", settings.format)
+			os.Exit(1)
+		}
+		switch t.Distribution(strings.ToLower(settings.distribution)) {
+		case t.Elasticsearch, t.OpenSearch:
+		default:
+			fmt.Printf("invalid distribution: %q\n", settings.distribution)
+			os.Exit(1)
+		}
+		if settings.configMapName == "" {
+			settings.configMapName = settings.IndexPrefix + "-templates"
+		}
+	}
+
+	d := t.Distribution(strings.ToLower(settings.distribution))
+	version, err := t.ParseVersion(d, settings.version)
+	if err != nil {
+		fmt.Printf("invalid es-version %q: %v\n", settings.version, err)
+		os.Exit(1)
+	}
+	tplSvc, err := t.New(settings.Config, version)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	composable, err := settings.useComposable(version.SupportsComposableTemplates())
+	if err != nil {
+		fmt.Printf("%v by %s\n", err, version)
+		os.Exit(1)
+	}
+
+	types := templateTypes
+	if len(settings.types) > 0 {
+		types = nil
+		for _, typ := range settings.types {
+			types = append(types, t.IndexTemplateType(typ))
+		}
+	}
+
+	tpls, err := renderTemplates(tplSvc, types, composable)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if err = writeTemplates(os.Stdout, tpls, settings.format, settings.outputDir,
+		settings.configMapName); err != nil {
+		fmt.Printf("unable to write templates: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// renderTemplates returns the templates of the provided types, preceded by
+// their lifecycle policies. Composable index templates are preceded by the
+// component templates they are composed of.
+func renderTemplates(tplSvc *t.Service, types []t.IndexTemplateType, composable bool) ([]renderedTemplate, error) {
+	var tpls []renderedTemplate
+	for _, typ := range types {
+		if policy := tplSvc.LifecyclePolicyByType(typ); policy != nil {
+			tpls = append(tpls, renderedTemplate{tplSvc.LifecyclePolicyKey(typ), *policy})
+		}
+		if policy := tplSvc.ISMPolicyByType(typ); policy != nil {
+			tpls = append(tpls, renderedTemplate{tplSvc.LifecyclePolicyKey(typ), *policy})
+		}
+	}
+	if composable {
+		tpls = append(tpls, renderedTemplate{
+			tplSvc.SettingsComponentKey(), tplSvc.SettingsComponentTemplate(),
+		})
+	}
+	for _, typ := range types {
+		if !composable {
+			tpl := tplSvc.TemplateByType(typ)
+			if tpl == nil {
+				return nil, fmt.Errorf("%s template not supported", typ)
+			}
+			tpls = append(tpls, renderedTemplate{tplSvc.IndexTemplateKey(typ), *tpl})
+			continue
+		}
+		component := tplSvc.ComponentTemplateByType(typ)
+		tpl := tplSvc.IndexTemplateByType(typ)
+		if component == nil || tpl == nil {
+			return nil, fmt.Errorf("%s template not supported", typ)
+		}
+		tpls = append(tpls,
+			renderedTemplate{tplSvc.ComponentTemplateKey(typ), *component},
+			renderedTemplate{tplSvc.IndexTemplateKey(typ), *tpl},
+		)
+	}
+	return tpls, nil
+}
+
+// writeTemplates writes the templates in the provided format. Without output
+// directory a single template is written as is to w, multiple templates are
+// keyed by name.
+func writeTemplates(w io.Writer, tpls []renderedTemplate, format, outputDir, configMapName string) error {
+	docs := make(map[string]string, len(tpls))
+	for _, tpl := range tpls {
+		doc, err := tpl.tpl.Serialize(true)
+		if err != nil {
+			return err
+		}
+		docs[tpl.name] = doc
+	}
+
+	if format == formatConfigMap {
+		cm := configMap{APIVersion: "v1", Kind: "ConfigMap", Data: make(map[string]string)}
+		cm.Metadata.Name = configMapName
+		for name, doc := range docs {
+			// YAML block scalars can't hold tab indentation
+			var buf bytes.Buffer
+			if err := json.Indent(&buf, []byte(doc), "", "  "); err != nil {
+				return err
+			}
+			cm.Data[name+".json"] = buf.String()
+		}
+		b, err := yaml.Marshal(cm)
+		if err != nil {
+			return err
+		}
+		if outputDir == "" {
+			_, err = w.Write(b)
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(outputDir, configMapName+".yaml"), b, 0644)
+	}
+
+	if outputDir != "" {
+		for _, tpl := range tpls {
+			b, err := encode(docs[tpl.name], format)
+			if err != nil {
+				return err
+			}
+			if err = ioutil.WriteFile(filepath.Join(outputDir, tpl.name+"."+format), b, 0644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	doc := docs[tpls[0].name]
+	if len(tpls) > 1 {
+		keyed := make(map[string]json.RawMessage, len(docs))
+		for name, d := range docs {
+			keyed[name] = json.RawMessage(d)
+		}
+		b, err := json.MarshalIndent(keyed, "", "\t")
+		if err != nil {
+			return err
+		}
+		doc = string(b)
+	}
+	b, err := encode(doc, format)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// encode returns the serialized JSON document in the provided format.
+func encode(doc, format string) ([]byte, error) {
+	if format == formatJSON {
+		return []byte(doc + "\n"), nil
+	}
+	// JSON is valid YAML, a MapSlice keeps the order of the properties.
+	var m yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(doc), &m); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(m)
+}
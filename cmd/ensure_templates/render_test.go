@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	t "github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+func TestRenderTemplates(tt *testing.T) {
+	for _, item := range []struct {
+		name       string
+		version    t.Version
+		retention  int
+		types      []t.IndexTemplateType
+		composable bool
+		want       func(s *t.Service) []string
+	}{
+		{"legacy", t.ElasticsearchVersion(7, 10), 0, templateTypes, false,
+			func(s *t.Service) []string {
+				return []string{
+					s.IndexTemplateKey(t.AutoCompleteType),
+					s.IndexTemplateKey(t.SpanType),
+					s.IndexTemplateKey(t.DependencyType),
+				}
+			}},
+		{"composable", t.ElasticsearchVersion(7, 10), 0, []t.IndexTemplateType{t.SpanType}, true,
+			func(s *t.Service) []string {
+				return []string{
+					s.SettingsComponentKey(),
+					s.ComponentTemplateKey(t.SpanType),
+					s.IndexTemplateKey(t.SpanType),
+				}
+			}},
+		{"lifecycle policy", t.ElasticsearchVersion(7, 10), 7, []t.IndexTemplateType{t.SpanType}, false,
+			func(s *t.Service) []string {
+				return []string{
+					s.LifecyclePolicyKey(t.SpanType),
+					s.IndexTemplateKey(t.SpanType),
+				}
+			}},
+		{"ism policy", t.OpenSearchVersion(2, 11), 7, []t.IndexTemplateType{t.SpanType}, true,
+			func(s *t.Service) []string {
+				return []string{
+					s.LifecyclePolicyKey(t.SpanType),
+					s.SettingsComponentKey(),
+					s.ComponentTemplateKey(t.SpanType),
+					s.IndexTemplateKey(t.SpanType),
+				}
+			}},
+	} {
+		cfg := t.DefaultConfig()
+		cfg.SpanRetentionDays = item.retention
+		tplSvc, err := t.New(cfg, item.version)
+		if err != nil {
+			tt.Fatalf("unable to create service: %v", err)
+		}
+		tpls, err := renderTemplates(tplSvc, item.types, item.composable)
+		if err != nil {
+			tt.Fatalf("[%s] unexpected error: %v", item.name, err)
+		}
+		var names []string
+		for _, tpl := range tpls {
+			names = append(names, tpl.name)
+		}
+		if want := item.want(tplSvc); !reflect.DeepEqual(names, want) {
+			tt.Errorf("[%s] templates: want %v, have %v", item.name, want, names)
+		}
+	}
+}
+
+func TestWriteTemplates(tt *testing.T) {
+	tplSvc, err := t.New(t.DefaultConfig(), t.ElasticsearchVersion(7, 10))
+	if err != nil {
+		tt.Fatalf("unable to create service: %v", err)
+	}
+	all, err := renderTemplates(tplSvc, templateTypes, false)
+	if err != nil {
+		tt.Fatalf("unable to render templates: %v", err)
+	}
+	span, err := renderTemplates(tplSvc, []t.IndexTemplateType{t.SpanType}, false)
+	if err != nil {
+		tt.Fatalf("unable to render templates: %v", err)
+	}
+	spanKey := tplSvc.IndexTemplateKey(t.SpanType)
+
+	for _, item := range []struct {
+		name      string
+		tpls      []renderedTemplate
+		format    string
+		outputDir bool
+		// files holds the expected output files, empty for stdout
+		files []string
+		// keys holds the expected top level keys of each document
+		keys []string
+	}{
+		{"single json", span, formatJSON, false, nil,
+			[]string{"index_patterns", "settings", "mappings"}},
+		{"single yaml", span, formatYAML, false, nil,
+			[]string{"index_patterns", "settings", "mappings"}},
+		{"keyed json", all, formatJSON, false, nil, sortedNames(all)},
+		{"keyed yaml", all, formatYAML, false, nil, sortedNames(all)},
+		{"files json", all, formatJSON, true, fileNames(all, formatJSON),
+			[]string{"index_patterns", "settings", "mappings"}},
+		{"files yaml", all, formatYAML, true, fileNames(all, formatYAML),
+			[]string{"index_patterns", "settings", "mappings"}},
+		{"configmap", all, formatConfigMap, false, nil,
+			[]string{"apiVersion", "kind", "metadata", "data"}},
+		{"configmap file", all, formatConfigMap, true, []string{"zipkin-templates.yaml"},
+			[]string{"apiVersion", "kind", "metadata", "data"}},
+	} {
+		var (
+			stdout    bytes.Buffer
+			outputDir string
+		)
+		if item.outputDir {
+			outputDir = tt.TempDir()
+		}
+		if err := writeTemplates(&stdout, item.tpls, item.format, outputDir,
+			"zipkin-templates"); err != nil {
+			tt.Fatalf("[%s] unexpected error: %v", item.name, err)
+		}
+
+		docs := [][]byte{stdout.Bytes()}
+		if item.outputDir {
+			if stdout.Len() > 0 {
+				tt.Errorf("[%s] unexpected stdout: %s", item.name, stdout.String())
+			}
+			docs = nil
+			matches, _ := filepath.Glob(filepath.Join(outputDir, "*"))
+			var files []string
+			for _, match := range matches {
+				files = append(files, filepath.Base(match))
+				b, err := ioutil.ReadFile(match)
+				if err != nil {
+					tt.Fatalf("[%s] unable to read %s: %v", item.name, match, err)
+				}
+				docs = append(docs, b)
+			}
+			if want := sortedStrings(item.files); !reflect.DeepEqual(files, want) {
+				tt.Errorf("[%s] files: want %v, have %v", item.name, want, files)
+			}
+		}
+
+		for _, doc := range docs {
+			// JSON is valid YAML, a MapSlice decodes the keys in order
+			var m yaml.MapSlice
+			if err := yaml.Unmarshal(doc, &m); err != nil {
+				tt.Fatalf("[%s] unable to decode %s: %v", item.name, doc, err)
+			}
+			var keys []string
+			for _, kv := range m {
+				keys = append(keys, kv.Key.(string))
+			}
+			if !reflect.DeepEqual(keys, item.keys) {
+				tt.Errorf("[%s] keys: want %v, have %v", item.name, item.keys, keys)
+			}
+			if item.format == formatJSON && !json.Valid(doc) {
+				tt.Errorf("[%s] invalid JSON: %s", item.name, doc)
+			}
+			if item.format == formatConfigMap {
+				checkConfigMap(tt, item.name, doc, item.tpls)
+			}
+		}
+	}
+
+	// a single template is written as is, matching the keyed document
+	var single, keyed bytes.Buffer
+	if err := writeTemplates(&single, span, formatJSON, "", ""); err != nil {
+		tt.Fatalf("unexpected error: %v", err)
+	}
+	if err := writeTemplates(&keyed, all, formatJSON, "", ""); err != nil {
+		tt.Fatalf("unexpected error: %v", err)
+	}
+	var singleDoc interface{}
+	var keyedDoc map[string]interface{}
+	if err := json.Unmarshal(single.Bytes(), &singleDoc); err != nil {
+		tt.Fatalf("unable to decode: %v", err)
+	}
+	if err := json.Unmarshal(keyed.Bytes(), &keyedDoc); err != nil {
+		tt.Fatalf("unable to decode: %v", err)
+	}
+	if !reflect.DeepEqual(singleDoc, keyedDoc[spanKey]) {
+		tt.Errorf("%s: keyed document doesn't match the single document", spanKey)
+	}
+}
+
+// checkConfigMap verifies the ConfigMap holds a tab-free JSON document per
+// template, keyed by file name.
+func checkConfigMap(tt *testing.T, name string, doc []byte, tpls []renderedTemplate) {
+	tt.Helper()
+	var cm configMap
+	if err := yaml.Unmarshal(doc, &cm); err != nil {
+		tt.Fatalf("[%s] unable to decode ConfigMap: %v", name, err)
+	}
+	if cm.APIVersion != "v1" || cm.Kind != "ConfigMap" || cm.Metadata.Name != "zipkin-templates" {
+		tt.Errorf("[%s] unexpected ConfigMap header: %+v", name, cm)
+	}
+	var keys []string
+	for key, data := range cm.Data {
+		keys = append(keys, key)
+		if strings.Contains(data, "\t") {
+			tt.Errorf("[%s] %s: unexpected tab indentation", name, key)
+		}
+		if !json.Valid([]byte(data)) {
+			tt.Errorf("[%s] %s: invalid JSON: %s", name, key, data)
+		}
+	}
+	sort.Strings(keys)
+	if want := fileNames(tpls, formatJSON); !reflect.DeepEqual(keys, want) {
+		tt.Errorf("[%s] data keys: want %v, have %v", name, want, keys)
+	}
+}
+
+func sortedNames(tpls []renderedTemplate) []string {
+	var names []string
+	for _, tpl := range tpls {
+		names = append(names, tpl.name)
+	}
+	return sortedStrings(names)
+}
+
+func fileNames(tpls []renderedTemplate, format string) []string {
+	var names []string
+	for _, tpl := range tpls {
+		names = append(names, tpl.name+"."+format)
+	}
+	return sortedStrings(names)
+}
+
+func sortedStrings(s []string) []string {
+	s = append([]string(nil), s...)
+	sort.Strings(s)
+	return s
+}
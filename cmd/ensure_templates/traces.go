@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	l "github.com/tetratelabs/log"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
+	t "github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+// deleteTraces deletes all spans of the provided traces across the span
+// indices, e.g. to handle erasure requests.
+func deleteTraces(args []string) {
+	// init our defaults
+	var settings = struct {
+		templateSettings
+		conn         connectionSettings
+		traceIDFile  string
+		pollInterval time.Duration
+		dryRun       bool
+		yes          bool
+	}{
+		templateSettings: defaultTemplateSettings(),
+		conn:             defaultConnectionSettings(),
+		pollInterval:     5 * time.Second,
+	}
+	// os env override
+	{
+		settings.loadEnv()
+		settings.conn.loadEnv()
+		if envEnabled("DRY_RUN") {
+			settings.dryRun = true
+		}
+		if envEnabled("ASSUME_YES") {
+			settings.yes = true
+		}
+	}
+
+	var (
+		traceIDs    []string
+		explicitYes bool
+	)
+	// flag handling
+	{
+		fs := pflag.NewFlagSet("delete-traces settings", pflag.ContinueOnError)
+		fs.SortFlags = false
+		fs.Usage = func() {
+			fmt.Fprintf(os.Stderr, "Usage: %s delete-traces [flags] [trace ID...]\n", os.Args[0])
+			fs.PrintDefaults()
+		}
+		fs.StringVarP(&settings.IndexPrefix, "prefix", "p",
+			settings.IndexPrefix, "index name prefix")
+		fs.BoolVar(&settings.disableStrictTraceID, "disable-strict-traceId",
+			settings.disableStrictTraceID,
+			"trace IDs are indexed with mixed 64/128-bit support")
+		fs.StringVar(&settings.traceIDFile, "trace-id-file", "",
+			"file holding the trace IDs to delete, one per line (- for stdin, requires yes or dry-run)")
+		fs.DurationVar(&settings.pollInterval, "poll-interval", settings.pollInterval,
+			"interval between delete task progress reports")
+		fs.BoolVar(&settings.dryRun, "dry-run", settings.dryRun,
+			"print the number of matching spans per index without deleting them")
+		fs.BoolVarP(&settings.yes, "yes", "y", settings.yes,
+			"do not ask for confirmation before deleting spans")
+		settings.conn.attachToFlagSet(fs)
+
+		logOpts.AttachToFlagSet(fs)
+
+		// parse FlagSet and exit on error
+		if err := fs.Parse(args); err != nil {
+			if err == pflag.ErrHelp {
+				os.Exit(0)
+			}
+			fmt.Printf("unable to parse settings: %+v\n", err)
+			os.Exit(1)
+		}
+
+		explicitYes = fs.Changed("yes")
+		traceIDs = fs.Args()
+		// the confirmation is read from stdin too
+		if settings.traceIDFile == "-" && !settings.yes && !settings.dryRun {
+			fmt.Println("trace-id-file - requires yes or dry-run, the confirmation is read from stdin")
+			os.Exit(1)
+		}
+		if settings.traceIDFile != "" {
+			ids, err := readTraceIDs(settings.traceIDFile)
+			if err != nil {
+				fmt.Printf("unable to read trace IDs: %v\n", err)
+				os.Exit(1)
+			}
+			traceIDs = append(traceIDs, ids...)
+		}
+		if len(traceIDs) == 0 {
+			fmt.Println("no trace IDs provided")
+			os.Exit(1)
+		}
+		if settings.pollInterval <= 0 {
+			fmt.Printf("invalid poll-interval: %s\n", settings.pollInterval)
+			os.Exit(1)
+		}
+		if err := settings.resolve(); err != nil {
+			fmt.Printf("%+v\n", err)
+			os.Exit(1)
+		}
+		if err := settings.conn.resolve(); err != nil {
+			fmt.Printf("%+v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// initialize the logging subsystem
+	if err := l.Configure(logOpts); err != nil {
+		fmt.Printf("failed to configure logging: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := settings.conn.context()
+	defer cancel()
+
+	client, err := settings.conn.connect(ctx)
+	if err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(exitCode(err))
+	}
+	tplSvc, err := t.New(settings.Config, client.Version())
+	if err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(1)
+	}
+
+	p, err := planTraceDelete(ctx, client, tplSvc, traceIDs, settings.pollInterval)
+	if err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(1)
+	}
+	if settings.dryRun {
+		p.print(os.Stdout)
+		return
+	}
+	// spans of other traces may be deleted, which ASSUME_YES does not cover
+	if warnings := p.warnings(); len(warnings) > 0 && settings.yes && !explicitYes {
+		for _, warning := range warnings {
+			log.Errorf("%s", warning)
+		}
+		log.Errorf("pass --yes to delete the spans without confirmation")
+		os.Exit(1)
+	}
+	if !settings.yes {
+		if err = p.confirm(ctx, os.Stdin, os.Stdout); err != nil {
+			log.Errorf("%v", err)
+			os.Exit(1)
+		}
+	}
+	if err = p.apply(); err != nil {
+		log.Errorf("%+v", err)
+		os.Exit(1)
+	}
+}
+
+// planTraceDelete plans the deletion of the spans of the provided traces. The
+// spans are deleted index by index to report the deleted counts per index.
+func planTraceDelete(ctx context.Context, client *es.Client, tplSvc *t.Service, traceIDs []string, pollInterval time.Duration) (plan, error) {
+	query, err := tplSvc.TraceIDQuery(traceIDs)
+	if err != nil {
+		return nil, err
+	}
+	pattern := tplSvc.IndexPattern(t.SpanType)
+	counts, err := client.CountDocumentsByIndex(ctx, pattern, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to count spans: %w", err)
+	}
+	if len(counts) == 0 {
+		log.Infof("no spans found for the %d traces", len(traceIDs))
+		return nil, nil
+	}
+
+	var (
+		indices []string
+		total   int64
+	)
+	for index, count := range counts {
+		indices = append(indices, index)
+		total += count
+	}
+	sort.Strings(indices)
+	a := action{kind: actionDelete, desc: "trace spans", key: pattern}
+	for _, index := range indices {
+		a.details = append(a.details, fmt.Sprintf("%s (%d spans)", index, counts[index]))
+	}
+	a.confirm = fmt.Sprintf("delete %d spans of %d traces from %d indices?",
+		total, len(traceIDs), len(indices))
+	if ambiguous := tplSvc.AmbiguousTraceIDs(traceIDs); len(ambiguous) > 0 {
+		a.warning = fmt.Sprintf("%d trace IDs are matched by their lower 64 bits, which other 128-bit traces sharing them also match: %s",
+			len(ambiguous), strings.Join(ambiguous, ", "))
+		a.confirm = fmt.Sprintf("delete %d spans of %d traces, and of 128-bit traces sharing their lower 64 bits, from %d indices?",
+			total, len(traceIDs), len(indices))
+	}
+	a.apply = func() (string, error) {
+		var deleted int64
+		for _, index := range indices {
+			n, err := deleteByQuery(ctx, client, index, query, pollInterval)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", index, err)
+			}
+			log.Infof("%s: %d spans deleted", index, n)
+			deleted += n
+		}
+		return fmt.Sprintf("%d spans deleted from %d indices", deleted, len(indices)), nil
+	}
+	return plan{a}, nil
+}
+
+// readTraceIDs reads the trace IDs from the file, one per line. Empty lines and
+// lines starting with # are ignored.
+func readTraceIDs(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var ids []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ids = append(ids, line)
+	}
+	return ids, scanner.Err()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	t "github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+func TestPlanTraceDelete(tt *testing.T) {
+	for _, item := range []struct {
+		name        string
+		strict      bool
+		traceIDs    []string
+		wantWarning string
+	}{
+		{"strict", true, []string{"463ac35c9f6413ad48485a3953bb6124", "48485a3953bb6124"}, ""},
+		{"128-bit only", false, []string{"463ac35c9f6413ad48485a3953bb6124"},
+			"1 trace IDs are matched by their lower 64 bits, which other 128-bit traces sharing them also match: 48485a3953bb6124"},
+		{"64-bit", false, []string{"463ac35c9f6413ad48485a3953bb6124", "0000000000000abc"},
+			"2 trace IDs are matched by their lower 64 bits, which other 128-bit traces sharing them also match: 48485a3953bb6124, 0000000000000abc"},
+	} {
+		cfg := t.DefaultConfig()
+		cfg.StrictTraceID = item.strict
+		tplSvc, err := t.New(cfg, t.ElasticsearchVersion(7, 10))
+		if err != nil {
+			tt.Fatalf("unable to create service: %v", err)
+		}
+		client := newTestClient(tt, elasticsearch710, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" || r.URL.Path != "/zipkin-span-*/_search" {
+				tt.Errorf("%s: unexpected request: %s %s", item.name, r.Method, r.URL)
+			}
+			_, _ = w.Write([]byte(`{"aggregations":{"indices":{"buckets":[{"key":"zipkin-span-2026-10-16","doc_count":12}]}}}`))
+		})
+
+		p, err := planTraceDelete(context.Background(), client, tplSvc, item.traceIDs, time.Second)
+		if err != nil {
+			tt.Fatalf("%s: unable to plan: %v", item.name, err)
+		}
+		if len(p) != 1 {
+			tt.Fatalf("%s: want a single action, got: %+v", item.name, p)
+		}
+		if p[0].warning != item.wantWarning {
+			tt.Errorf("%s: want warning %q, got: %q", item.name, item.wantWarning, p[0].warning)
+		}
+		// the warning is part of the plan and of the confirmation
+		var out bytes.Buffer
+		_ = p.confirm(context.Background(), strings.NewReader("n\n"), &out)
+		if item.wantWarning != "" && !strings.Contains(out.String(), "warning: "+item.wantWarning) {
+			tt.Errorf("%s: want warning in the confirmation, got: %s", item.name, out.String())
+		}
+	}
+}
@@ -5,6 +5,7 @@ go 1.19
 require (
 	github.com/spf13/pflag v1.0.5
 	github.com/tetratelabs/log v0.0.0-20210323000454-90a3a3e141b5
+	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
 	gopkg.in/yaml.v2 v2.4.0
 )
 
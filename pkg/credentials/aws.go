@@ -0,0 +1,92 @@
+package credentials
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AWSCredentials holds the credentials for signing requests to AWS.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// ReadAWS returns the AWS credentials the way the AWS SDKs find them: from the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment
+// variables, or else from the profile of the shared credentials file
+// (AWS_SHARED_CREDENTIALS_FILE, default ~/.aws/credentials). An empty profile
+// uses AWS_PROFILE, or "default". An explicit profile skips the environment
+// variables.
+func ReadAWS(profile string) (AWSCredentials, error) {
+	if profile == "" {
+		c := AWSCredentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if c.AccessKeyID != "" && c.SecretAccessKey != "" {
+			return c, nil
+		}
+		if profile = os.Getenv("AWS_PROFILE"); profile == "" {
+			profile = "default"
+		}
+	}
+
+	fileName := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if fileName == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return AWSCredentials{}, err
+		}
+		fileName = filepath.Join(home, ".aws", "credentials")
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("no AWS credentials in the environment: %w", err)
+	}
+	defer f.Close()
+
+	var (
+		c       AWSCredentials
+		section string
+		found   bool
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			found = found || section == profile
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if section != profile || len(kv) != 2 {
+			continue
+		}
+		switch value := strings.TrimSpace(kv[1]); strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "aws_access_key_id":
+			c.AccessKeyID = value
+		case "aws_secret_access_key":
+			c.SecretAccessKey = value
+		case "aws_session_token":
+			c.SessionToken = value
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return AWSCredentials{}, err
+	}
+	if !found {
+		return AWSCredentials{}, fmt.Errorf("profile %q not found in %s", profile, fileName)
+	}
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return AWSCredentials{}, fmt.Errorf("profile %q in %s has no access key", profile, fileName)
+	}
+	return c, nil
+}
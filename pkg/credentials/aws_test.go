@@ -0,0 +1,82 @@
+package credentials_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/credentials"
+)
+
+const dataAWS = `[default]
+aws_access_key_id = AKIDDEFAULT
+aws_secret_access_key = c2VjcmV0LWRlZmF1bHQ
+
+# temporary credentials
+[ops]
+aws_access_key_id=AKIDOPS
+aws_secret_access_key=c2VjcmV0LW9wcw
+aws_session_token=AQoDYXdzEJr
+`
+
+func TestReadAWS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "es-templater")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(dir+"/credentials", []byte(dataAWS), 0600); err != nil {
+		t.Fatalf("unable to create credentials file: %v", err)
+	}
+
+	for _, item := range []struct {
+		name    string
+		env     map[string]string
+		profile string
+		want    credentials.AWSCredentials
+		wantErr bool
+	}{
+		{
+			name: "environment",
+			env:  map[string]string{"AWS_ACCESS_KEY_ID": "AKIDENV", "AWS_SECRET_ACCESS_KEY": "c2VjcmV0LWVudg"},
+			want: credentials.AWSCredentials{AccessKeyID: "AKIDENV", SecretAccessKey: "c2VjcmV0LWVudg"},
+		},
+		{
+			name: "default profile",
+			want: credentials.AWSCredentials{AccessKeyID: "AKIDDEFAULT", SecretAccessKey: "c2VjcmV0LWRlZmF1bHQ"},
+		},
+		{
+			name: "env profile",
+			env:  map[string]string{"AWS_PROFILE": "ops"},
+			want: credentials.AWSCredentials{AccessKeyID: "AKIDOPS", SecretAccessKey: "c2VjcmV0LW9wcw", SessionToken: "AQoDYXdzEJr"},
+		},
+		{
+			name:    "explicit profile",
+			env:     map[string]string{"AWS_ACCESS_KEY_ID": "AKIDENV", "AWS_SECRET_ACCESS_KEY": "c2VjcmV0LWVudg"},
+			profile: "ops",
+			want:    credentials.AWSCredentials{AccessKeyID: "AKIDOPS", SecretAccessKey: "c2VjcmV0LW9wcw", SessionToken: "AQoDYXdzEJr"},
+		},
+		{name: "missing profile", profile: "dev", wantErr: true},
+	} {
+		t.Run(item.name, func(t *testing.T) {
+			for _, key := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE"} {
+				t.Setenv(key, item.env[key])
+			}
+			t.Setenv("AWS_SHARED_CREDENTIALS_FILE", dir+"/credentials")
+
+			got, err := credentials.ReadAWS(item.profile)
+			if item.wantErr {
+				if err == nil {
+					t.Errorf("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unable to read credentials: %v", err)
+			}
+			if got != item.want {
+				t.Errorf("want %+v, got %+v", item.want, got)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"path/filepath"
@@ -13,62 +14,122 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// formats of the credentials
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatKV   = "kv"
+)
+
+// Credentials holds the credentials for connecting to ES. Credentials not
+// found in a file are left empty.
+type Credentials struct {
+	Username    string
+	Password    string
+	APIKey      string
+	BearerToken string
+}
+
+// Templates holds the extraction paths of the credentials, as text/template
+// expressions. Empty templates use the defaults for the file format.
+type Templates struct {
+	Username    string
+	Password    string
+	APIKey      string
+	BearerToken string
+}
+
+// defaults for the JSON and YAML files, e.g. as rendered by Vault agent, and
+// for Vault secrets
+var defaultTemplates = Templates{
+	Username:    "{{ .data.username }}",
+	Password:    "{{ .data.password }}",
+	APIKey:      "{{ .data.api_key }}",
+	BearerToken: "{{ .data.token }}",
+}
+
 // ReadFile is used to extract user/pass credentials for connecting to ES from a file using the provided user/pass
 // extraction paths.
 func ReadFile(fileName, tplUser, tplPass string) (user string, pass string, err error) {
-	var (
-		b   []byte
-		obj interface{}
-	)
-
-	b, err = ioutil.ReadFile(fileName)
+	c, err := Read(fileName, Templates{Username: tplUser, Password: tplPass})
 	if err != nil {
 		return "", "", err
 	}
+	return c.Username, c.Password, nil
+}
 
+// Read extracts the credentials for connecting to ES from a JSON, YAML or
+// key=value file using the provided extraction paths.
+func Read(fileName string, tpls Templates) (Credentials, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return Credentials{}, err
+	}
+	format := FormatKV
 	switch strings.ToLower(filepath.Ext(fileName)) {
 	case ".yml", ".yaml":
-		obj, err = deserializeYAML(b)
-		if err != nil {
-			return
-		}
+		format = FormatYAML
 	case ".json":
-		obj, err = deserializeJSON(b)
-		if err != nil {
-			return
-		}
-	default:
-		obj, err = deserializeKV(b)
-		if err != nil {
-			return
-		}
-		if tplUser == "" {
-			tplUser = "{{ .username }}"
-		}
-		if tplPass == "" {
-			tplPass = "{{ .password }}"
-		}
+		format = FormatJSON
 	}
-
-	if tplUser == "" {
-		tplUser = "{{ .data.username }}"
-	}
-
-	if tplPass == "" {
-		tplPass = "{{ .data.password }}"
-	}
-
-	user, err = extractor(obj, tplUser)
+	obj, defaults, err := deserialize(b, format)
 	if err != nil {
-		return "", "", err
+		return Credentials{}, err
 	}
+	return extract(obj, tpls, defaults)
+}
 
-	pass, err = extractor(obj, tplPass)
-	if err != nil {
-		return "", "", err
+// deserialize deserializes the data in the format and returns it with the
+// default templates of the format.
+func deserialize(b []byte, format string) (interface{}, Templates, error) {
+	var (
+		obj interface{}
+		err error
+	)
+	switch format {
+	case FormatYAML:
+		obj, err = deserializeYAML(b)
+	case FormatJSON:
+		obj, err = deserializeJSON(b)
+	case FormatKV:
+		obj, err = deserializeKV(b)
+		return obj, Templates{
+			Username:    "{{ .username }}",
+			Password:    "{{ .password }}",
+			APIKey:      "{{ .api_key }}",
+			BearerToken: "{{ .token }}",
+		}, err
+	default:
+		err = fmt.Errorf("unknown format %q", format)
 	}
+	return obj, defaultTemplates, err
+}
 
-	return user, pass, nil
+// extract extracts the credentials from the object, using the default
+// templates for the templates not provided.
+func extract(obj interface{}, tpls, defaults Templates) (Credentials, error) {
+	var (
+		c   Credentials
+		err error
+	)
+	for _, field := range []struct {
+		value    *string
+		tpl, def string
+	}{
+		{&c.Username, tpls.Username, defaults.Username},
+		{&c.Password, tpls.Password, defaults.Password},
+		{&c.APIKey, tpls.APIKey, defaults.APIKey},
+		{&c.BearerToken, tpls.BearerToken, defaults.BearerToken},
+	} {
+		tpl := field.tpl
+		if tpl == "" {
+			tpl = field.def
+		}
+		if *field.value, err = extractor(obj, tpl); err != nil {
+			return Credentials{}, err
+		}
+	}
+	return c, nil
 }
 
 // extractor extracts a value from object based on the provided template.
@@ -84,6 +145,11 @@ func extractor(obj interface{}, tpl string) (string, error) {
 		return "", err
 	}
 
+	// missing keys render as "<no value>"
+	if b.String() == "<no value>" {
+		return "", nil
+	}
+
 	return b.String(), nil
 }
 
@@ -110,12 +176,13 @@ func deserializeYAML(b []byte) (interface{}, error) {
 func deserializeKV(b []byte) (interface{}, error) {
 	data := make(map[string]string)
 
-	for _, line := range bytes.Split(b, []byte("\n")) {
+	for i, line := range bytes.Split(b, []byte("\n")) {
 		kv := bytes.SplitN(line, []byte("="), 2)
 		if len(kv) == 2 {
 			data[string(bytes.TrimSpace(kv[0]))] = string(bytes.TrimSpace(kv[1]))
 		} else if len(bytes.TrimSpace(kv[0])) > 0 {
-			log.Printf("unable to parse <key>=<value> pair for: %s", string(kv[0]))
+			// the line may hold a secret, so it is not logged
+			log.Printf("unable to parse <key>=<value> pair on line %d", i+1)
 		}
 	}
 
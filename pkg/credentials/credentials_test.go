@@ -68,3 +68,63 @@ func TestReadFile(t *testing.T) {
 		}
 	}
 }
+
+func TestRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "es-templater")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, item := range []struct {
+		credFileName string
+		credFileData string
+		tpls         credentials.Templates
+		want         credentials.Credentials
+	}{
+		{
+			credFileName: "apikey.json",
+			credFileData: `{"data": {"api_key": "VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw=="}}`,
+			want:         credentials.Credentials{APIKey: "VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw=="},
+		},
+		{
+			credFileName: "token.yaml",
+			credFileData: "data:\n  token: dGhpcyBpcyBhIHRva2Vu\n",
+			want:         credentials.Credentials{BearerToken: "dGhpcyBpcyBhIHRva2Vu"},
+		},
+		{
+			credFileName: "apikey.kval",
+			credFileData: "api_key = VuaCfGcBCdbkQm-e5aOx:ui2lp2axTNmsyakw9tvNnw\ntoken = dGhpcyBpcyBhIHRva2Vu",
+			want: credentials.Credentials{
+				APIKey:      "VuaCfGcBCdbkQm-e5aOx:ui2lp2axTNmsyakw9tvNnw",
+				BearerToken: "dGhpcyBpcyBhIHRva2Vu",
+			},
+		},
+		{
+			credFileName: "custom.json",
+			credFileData: `{"es": {"id": "VuaCfGcBCdbkQm-e5aOx", "key": "ui2lp2axTNmsyakw9tvNnw"}}`,
+			tpls:         credentials.Templates{APIKey: "{{ .es.id }}:{{ .es.key }}"},
+			want:         credentials.Credentials{APIKey: "VuaCfGcBCdbkQm-e5aOx:ui2lp2axTNmsyakw9tvNnw"},
+		},
+		{
+			credFileName: "creds.json",
+			credFileData: dataJSON,
+			want: credentials.Credentials{
+				Username: "v-root-my-role-cUSnMKfKIbqWbkEhHf3o-1585155604",
+				Password: "A1a-0Ni9XOQddSDVbmiB",
+			},
+		},
+	} {
+		if err = ioutil.WriteFile(dir+"/"+item.credFileName, []byte(item.credFileData), 0644); err != nil {
+			t.Fatalf("unable to create creds file: %v", err)
+		}
+		got, err := credentials.Read(dir+"/"+item.credFileName, item.tpls)
+		if err != nil {
+			t.Errorf("%s: unable to parse creds file: %v", item.credFileName, err)
+			continue
+		}
+		if got != item.want {
+			t.Errorf("%s: want %+v, got %+v", item.credFileName, item.want, got)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCommandTimeout is the default timeout of a credentials command.
+const DefaultCommandTimeout = 10 * time.Second
+
+// CommandConfig holds the settings of a credentials command.
+type CommandConfig struct {
+	// Command is the executable and its arguments, separated by spaces. It is
+	// run without a shell.
+	Command string
+	// Format is the format of the output, one of FormatJSON, FormatYAML and
+	// FormatKV, or empty to detect it.
+	Format string
+	// Templates are the extraction paths, which default to the ones of the
+	// format as for files.
+	Templates Templates
+	// Timeout limits each run, DefaultCommandTimeout if 0.
+	Timeout time.Duration
+	// CacheTTL is how long the credentials are reused before running the
+	// command again. 0 reuses them for the lifetime of the Command.
+	CacheTTL time.Duration
+}
+
+// Command runs an external credential helper, the way git and docker do,
+// and extracts the credentials from its output. The output and stderr of the
+// command are never logged or returned in errors as they may hold secrets.
+type Command struct {
+	cfg  CommandConfig
+	args []string
+
+	mu      sync.Mutex
+	creds   Credentials
+	expires time.Time
+	cached  bool
+}
+
+// NewCommand returns a credentials command for the provided settings.
+func NewCommand(cfg CommandConfig) (*Command, error) {
+	args := strings.Fields(cfg.Command)
+	if len(args) == 0 {
+		return nil, errors.New("no credentials command")
+	}
+	switch cfg.Format {
+	case "", FormatJSON, FormatYAML, FormatKV:
+	default:
+		return nil, fmt.Errorf("invalid credentials command format: %q", cfg.Format)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultCommandTimeout
+	}
+	return &Command{cfg: cfg, args: args}, nil
+}
+
+// Get returns the cached credentials, running the command if there are none
+// or they expired.
+func (c *Command) Get(ctx context.Context) (Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cached && (c.cfg.CacheTTL <= 0 || time.Now().Before(c.expires)) {
+		return c.creds, nil
+	}
+	creds, err := c.run(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+	c.creds, c.expires, c.cached = creds, time.Now().Add(c.cfg.CacheTTL), true
+	return creds, nil
+}
+
+// run runs the command and extracts the credentials from its output.
+func (c *Command) run(ctx context.Context) (Credentials, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.args[0], c.args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// processes started by the command may keep the output open after it is
+	// killed, so the wait is not bound to them
+	done := make(chan error, 1)
+	go func() { done <- cmd.Run() }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return Credentials{}, fmt.Errorf("credentials command timed out after %s", c.cfg.Timeout)
+	case ctx.Err() != nil:
+		return Credentials{}, ctx.Err()
+	case err != nil:
+		return Credentials{}, fmt.Errorf("credentials command failed: %v (%d bytes of stderr suppressed)",
+			err, stderr.Len())
+	}
+
+	format := c.cfg.Format
+	if format == "" {
+		format = detectFormat(stdout.Bytes())
+	}
+	obj, defaults, err := deserialize(stdout.Bytes(), format)
+	if err != nil {
+		// parse errors may quote the output
+		return Credentials{}, fmt.Errorf("unable to parse the output of the credentials command as %s", format)
+	}
+	creds, err := extract(obj, c.cfg.Templates, defaults)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("unable to extract the credentials from the output of the credentials command: %w", err)
+	}
+	return creds, nil
+}
+
+// detectFormat returns FormatJSON for an object, FormatYAML for a mapping and
+// FormatKV otherwise.
+func detectFormat(b []byte) string {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		return FormatJSON
+	}
+	if obj, err := deserializeYAML(b); err == nil {
+		if _, ok := obj.(map[interface{}]interface{}); ok {
+			return FormatYAML
+		}
+	}
+	return FormatKV
+}
@@ -0,0 +1,134 @@
+package credentials_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/credentials"
+)
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helper scripts require a POSIX shell")
+	}
+	dir, err := ioutil.TempDir("", "es-templater")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// helper writes a credential helper script counting its runs
+	helper := func(name, script string) string {
+		fileName := filepath.Join(dir, name)
+		script = "#!/bin/sh\necho run >> " + fileName + ".runs\n" + script
+		if err := ioutil.WriteFile(fileName, []byte(script), 0700); err != nil {
+			t.Fatalf("unable to create helper: %v", err)
+		}
+		return fileName
+	}
+
+	for _, item := range []struct {
+		name    string
+		script  string
+		cfg     credentials.CommandConfig
+		want    credentials.Credentials
+		wantErr string
+	}{
+		{
+			name:   "json",
+			script: `echo '{"data": {"username": "zipkin", "password": "s3cr3t"}}'`,
+			want:   credentials.Credentials{Username: "zipkin", Password: "s3cr3t"},
+		},
+		{
+			name:   "flat json",
+			script: `echo '{"Username": "zipkin", "Secret": "s3cr3t"}'`,
+			cfg: credentials.CommandConfig{Templates: credentials.Templates{
+				Username: "{{ .Username }}", Password: "{{ .Secret }}",
+			}},
+			want: credentials.Credentials{Username: "zipkin", Password: "s3cr3t"},
+		},
+		{
+			name:   "yaml",
+			script: "printf 'data:\\n  token: dGhpcyBpcyBhIHRva2Vu\\n'",
+			want:   credentials.Credentials{BearerToken: "dGhpcyBpcyBhIHRva2Vu"},
+		},
+		{
+			name:   "kv",
+			script: "printf 'api_key = VuaCfGcBCdbkQm-e5aOx:ui2lp2axTNmsyakw9tvNnw\\n'",
+			want:   credentials.Credentials{APIKey: "VuaCfGcBCdbkQm-e5aOx:ui2lp2axTNmsyakw9tvNnw"},
+		},
+		{
+			name:    "failure",
+			script:  "echo 'password=s3cr3t' >&2\nexit 1",
+			wantErr: "credentials command failed",
+		},
+		{
+			name:    "invalid output",
+			script:  "echo '{\"password\": s3cr3t'",
+			wantErr: "unable to parse",
+		},
+		{
+			name:    "timeout",
+			script:  "sleep 5",
+			cfg:     credentials.CommandConfig{Timeout: 50 * time.Millisecond},
+			wantErr: "timed out",
+		},
+	} {
+		cfg := item.cfg
+		cfg.Command = helper(strings.ReplaceAll(item.name, " ", "-"), item.script) + " get"
+		cmd, err := credentials.NewCommand(cfg)
+		if err != nil {
+			t.Fatalf("%s: unable to create command: %v", item.name, err)
+		}
+		got, err := cmd.Get(context.Background())
+		if item.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), item.wantErr) {
+				t.Errorf("%s: want error %q, got %v", item.name, item.wantErr, err)
+			} else if strings.Contains(err.Error(), "s3cr3t") {
+				t.Errorf("%s: error leaks the output: %v", item.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", item.name, err)
+			continue
+		}
+		if got != item.want {
+			t.Errorf("%s: want %+v, got %+v", item.name, item.want, got)
+		}
+	}
+
+	// the credentials are cached until they expire
+	for _, item := range []struct {
+		name     string
+		ttl      time.Duration
+		wantRuns int
+	}{
+		{"cached", 0, 1},
+		{"expired", time.Nanosecond, 3},
+	} {
+		fileName := helper(item.name, `echo '{"data": {"username": "zipkin"}}'`)
+		cmd, err := credentials.NewCommand(credentials.CommandConfig{Command: fileName, CacheTTL: item.ttl})
+		if err != nil {
+			t.Fatalf("%s: unable to create command: %v", item.name, err)
+		}
+		for i := 0; i < 3; i++ {
+			if _, err = cmd.Get(context.Background()); err != nil {
+				t.Fatalf("%s: unexpected error: %v", item.name, err)
+			}
+		}
+		b, err := ioutil.ReadFile(fileName + ".runs")
+		if err != nil {
+			t.Fatalf("%s: unable to read runs: %v", item.name, err)
+		}
+		if runs := strings.Count(string(b), "run"); runs != item.wantRuns {
+			t.Errorf("%s: want %d runs, got %d", item.name, item.wantRuns, runs)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadSecret returns the content of a file holding a single secret, as
+// mounted by Docker secrets, without its trailing newlines.
+func ReadSecret(fileName string) (string, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// ReadDir extracts the credentials from a directory holding one file per
+// key, the way Kubernetes mounts secrets. The keys are the ones of key=value
+// files: username, password, api_key and token. Missing keys are left empty,
+// a directory without any of them is an error.
+func ReadDir(dir string) (Credentials, error) {
+	var (
+		c     Credentials
+		found bool
+	)
+	for _, field := range []struct {
+		value *string
+		key   string
+	}{
+		{&c.Username, "username"},
+		{&c.Password, "password"},
+		{&c.APIKey, "api_key"},
+		{&c.BearerToken, "token"},
+	} {
+		value, err := ReadSecret(filepath.Join(dir, field.key))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Credentials{}, err
+		}
+		*field.value, found = value, true
+	}
+	if !found {
+		if _, err := os.Stat(dir); err != nil {
+			return Credentials{}, err
+		}
+		return Credentials{}, fmt.Errorf("no username, password, api_key or token file in %s", dir)
+	}
+	return c, nil
+}
@@ -0,0 +1,64 @@
+package credentials_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/credentials"
+)
+
+func TestReadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "es-templater")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, item := range []struct {
+		name    string
+		files   map[string]string
+		want    credentials.Credentials
+		wantErr bool
+	}{
+		{
+			name:  "basic auth",
+			files: map[string]string{"username": "zipkin\n", "password": "pa ss\r\n", "ca.crt": "-----BEGIN CERTIFICATE-----"},
+			want:  credentials.Credentials{Username: "zipkin", Password: "pa ss"},
+		},
+		{
+			name:  "api key",
+			files: map[string]string{"api_key": "VuaCfGcBCdbkQm-e5aOx:ui2lp2axTNmsyakw9tvNnw"},
+			want:  credentials.Credentials{APIKey: "VuaCfGcBCdbkQm-e5aOx:ui2lp2axTNmsyakw9tvNnw"},
+		},
+		{name: "empty", files: map[string]string{"other": "x"}, wantErr: true},
+		{name: "missing", wantErr: true},
+	} {
+		secretDir := filepath.Join(dir, item.name)
+		if item.files != nil {
+			if err = os.Mkdir(secretDir, 0700); err != nil {
+				t.Fatalf("unable to create secret dir: %v", err)
+			}
+		}
+		for key, value := range item.files {
+			if err = ioutil.WriteFile(filepath.Join(secretDir, key), []byte(value), 0600); err != nil {
+				t.Fatalf("unable to create secret file: %v", err)
+			}
+		}
+		got, err := credentials.ReadDir(secretDir)
+		if item.wantErr {
+			if err == nil {
+				t.Errorf("%s: want error, got nil", item.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", item.name, err)
+			continue
+		}
+		if got != item.want {
+			t.Errorf("%s: want %+v, got %+v", item.name, item.want, got)
+		}
+	}
+}
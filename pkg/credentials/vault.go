@@ -0,0 +1,289 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultKubernetesTokenFile holds the service account token mounted in pods.
+const DefaultKubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultConfig holds the settings to read credentials from HashiCorp Vault.
+type VaultConfig struct {
+	// Address is the base URL of Vault, e.g. https://vault:8200.
+	Address string
+	// CACert is the PEM file of the CA certificates to trust, if not the
+	// system ones.
+	CACert string
+	// Namespace is the Vault Enterprise namespace.
+	Namespace string
+	// Token authenticates to Vault. Without a token, Kubernetes auth is used
+	// with KubernetesRole.
+	Token string
+	// KubernetesRole is the role to log in with the service account token.
+	KubernetesRole string
+	// KubernetesMount is the mount path of the Kubernetes auth method,
+	// default "kubernetes".
+	KubernetesMount string
+	// KubernetesTokenFile is the service account token, default
+	// DefaultKubernetesTokenFile.
+	KubernetesTokenFile string
+	// SecretPath is the path of the secret to read, e.g.
+	// "database/creds/zipkin" for dynamic database credentials, "secret/zipkin"
+	// for KV v1 or "secret/data/zipkin" for KV v2.
+	SecretPath string
+}
+
+// Lease holds the lease of a dynamic secret.
+type Lease struct {
+	ID        string
+	Duration  time.Duration
+	Renewable bool
+}
+
+// Vault reads credentials from the HTTP API of HashiCorp Vault.
+type Vault struct {
+	cfg    VaultConfig
+	client *http.Client
+	token  string
+	// the lease of the token of the Kubernetes login, nil for the configured
+	// token, which is not renewed
+	tokenLease *Lease
+}
+
+type vaultSecret struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int64                  `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+// NewVault returns a Vault client, logged in with Kubernetes auth if no token
+// is configured.
+func NewVault(ctx context.Context, cfg VaultConfig) (*Vault, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("no Vault address")
+	}
+	if cfg.Token == "" && cfg.KubernetesRole == "" {
+		return nil, errors.New("no Vault token or Kubernetes role")
+	}
+	if cfg.KubernetesMount == "" {
+		cfg.KubernetesMount = "kubernetes"
+	}
+	if cfg.KubernetesTokenFile == "" {
+		cfg.KubernetesTokenFile = DefaultKubernetesTokenFile
+	}
+	v := &Vault{cfg: cfg, client: &http.Client{Timeout: time.Minute}, token: cfg.Token}
+	if cfg.CACert != "" {
+		b, err := ioutil.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load Vault CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if ok := pool.AppendCertsFromPEM(b); !ok {
+			return nil, errors.New("not a valid Vault CA certificate")
+		}
+		v.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	if v.token == "" {
+		jwt, err := ioutil.ReadFile(cfg.KubernetesTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read service account token: %w", err)
+		}
+		var secret vaultSecret
+		if err = v.call(ctx, "POST", "auth/"+strings.Trim(cfg.KubernetesMount, "/")+"/login", map[string]string{
+			"role": cfg.KubernetesRole,
+			"jwt":  strings.TrimSpace(string(jwt)),
+		}, &secret); err != nil {
+			return nil, fmt.Errorf("unable to log in to Vault: %w", err)
+		}
+		if secret.Auth == nil || secret.Auth.ClientToken == "" {
+			return nil, errors.New("unable to log in to Vault: no client token")
+		}
+		v.token = secret.Auth.ClientToken
+		if secret.Auth.LeaseDuration > 0 {
+			v.tokenLease = &Lease{
+				Duration:  time.Duration(secret.Auth.LeaseDuration) * time.Second,
+				Renewable: secret.Auth.Renewable,
+			}
+		}
+	}
+	return v, nil
+}
+
+// Read extracts the credentials from the configured secret using the provided
+// extraction paths, which default to the ones of JSON files. The data of KV v2
+// secrets is unwrapped, so the same templates work for KV v1, KV v2 and
+// database secrets. The lease is nil for secrets without one.
+func (v *Vault) Read(ctx context.Context, tpls Templates) (Credentials, *Lease, error) {
+	var secret vaultSecret
+	if err := v.call(ctx, "GET", v.cfg.SecretPath, nil, &secret); err != nil {
+		return Credentials{}, nil, fmt.Errorf("unable to read %s: %w", v.cfg.SecretPath, err)
+	}
+	data := secret.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok = data["metadata"]; ok {
+			data = inner
+		}
+	}
+	c, err := extract(map[string]interface{}{
+		"lease_id":       secret.LeaseID,
+		"lease_duration": secret.LeaseDuration,
+		"renewable":      secret.Renewable,
+		"data":           data,
+	}, tpls, defaultTemplates)
+	if err != nil {
+		return Credentials{}, nil, err
+	}
+	if secret.LeaseID == "" {
+		return c, nil, nil
+	}
+	return c, &Lease{
+		ID:        secret.LeaseID,
+		Duration:  time.Duration(secret.LeaseDuration) * time.Second,
+		Renewable: secret.Renewable,
+	}, nil
+}
+
+// Renew renews the lease for its duration and returns the renewed lease.
+func (v *Vault) Renew(ctx context.Context, lease Lease) (Lease, error) {
+	var secret vaultSecret
+	if err := v.call(ctx, "PUT", "sys/leases/renew", map[string]interface{}{
+		"lease_id":  lease.ID,
+		"increment": int64(lease.Duration / time.Second),
+	}, &secret); err != nil {
+		return lease, fmt.Errorf("unable to renew lease %s: %w", lease.ID, err)
+	}
+	return Lease{
+		ID:        lease.ID,
+		Duration:  time.Duration(secret.LeaseDuration) * time.Second,
+		Renewable: secret.Renewable,
+	}, nil
+}
+
+// RenewToken renews the token of the Kubernetes login for its duration. Vault
+// revokes the leases of a token once it expires, so it has to be kept alive
+// with the leases.
+func (v *Vault) RenewToken(ctx context.Context) error {
+	if v.tokenLease == nil {
+		return nil
+	}
+	var secret vaultSecret
+	if err := v.call(ctx, "PUT", "auth/token/renew-self", map[string]interface{}{
+		"increment": int64(v.tokenLease.Duration / time.Second),
+	}, &secret); err != nil {
+		return fmt.Errorf("unable to renew Vault token: %w", err)
+	}
+	if secret.Auth == nil {
+		return errors.New("unable to renew Vault token: no auth in response")
+	}
+	renewed := time.Duration(secret.Auth.LeaseDuration) * time.Second
+	if renewed < v.tokenLease.Duration/3 {
+		return fmt.Errorf("the Vault token reached its maximum TTL, expires in %s", renewed)
+	}
+	v.tokenLease.Duration, v.tokenLease.Renewable = renewed, secret.Auth.Renewable
+	return nil
+}
+
+// KeepAlive renews the lease, and the token of the Kubernetes login holding
+// it, after two thirds of their durations until the context is done. It
+// returns an error once either can not be renewed, e.g. when it reached its
+// maximum TTL, as the credentials expire with them.
+func (v *Vault) KeepAlive(ctx context.Context, lease Lease) error {
+	leaseDue := time.Now().Add(lease.Duration * 2 / 3)
+	var tokenDue time.Time
+	if v.tokenLease != nil {
+		tokenDue = time.Now().Add(v.tokenLease.Duration * 2 / 3)
+	}
+	for {
+		if !lease.Renewable {
+			return fmt.Errorf("lease %s is not renewable", lease.ID)
+		}
+		if v.tokenLease != nil && !v.tokenLease.Renewable {
+			return errors.New("the Vault token is not renewable")
+		}
+		next := leaseDue
+		if !tokenDue.IsZero() && tokenDue.Before(next) {
+			next = tokenDue
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		if !tokenDue.IsZero() && !time.Now().Before(tokenDue) {
+			if err := v.RenewToken(ctx); err != nil {
+				return err
+			}
+			tokenDue = time.Now().Add(v.tokenLease.Duration * 2 / 3)
+		}
+		if time.Now().Before(leaseDue) {
+			continue
+		}
+		renewed, err := v.Renew(ctx, lease)
+		if err != nil {
+			return err
+		}
+		if renewed.Duration < lease.Duration/3 {
+			return fmt.Errorf("lease %s reached its maximum TTL, expires in %s", lease.ID, renewed.Duration)
+		}
+		lease = renewed
+		leaseDue = time.Now().Add(lease.Duration * 2 / 3)
+	}
+}
+
+// call sends a request to the Vault API and decodes the response into res.
+func (v *Vault) call(ctx context.Context, method, path string, body, res interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	u := strings.TrimSuffix(v.cfg.Address, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return err
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		if len(e.Errors) > 0 {
+			return fmt.Errorf("status %d: %s", resp.StatusCode, strings.Join(e.Errors, "; "))
+		}
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
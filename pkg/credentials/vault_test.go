@@ -0,0 +1,226 @@
+package credentials_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/credentials"
+)
+
+const (
+	vaultKVv1 = `{"lease_duration":2764800,"renewable":false,"data":{"username":"zipkin","password":"kv1-secret"}}`
+	vaultKVv2 = `{"data":{"data":{"api_key":"VuaCfGcBCdbkQm-e5aOx:ui2lp2axTNmsyakw9tvNnw"},"metadata":{"version":3}}}`
+	vaultDB   = `{"lease_id":"database/creds/zipkin/6YWVPFq0BIwkIfsepBSY8dn3","lease_duration":3600,"renewable":true,` +
+		`"data":{"password":"A1a-0Ni9XOQddSDVbmiB","username":"v-kubernetes-zipkin-cUSnMKfKIbqWbkEhHf3o-1585155604"}}`
+)
+
+func TestVault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "es-templater")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	jwtFile := dir + "/token"
+	if err = ioutil.WriteFile(jwtFile, []byte("service-account-jwt\n"), 0600); err != nil {
+		t.Fatalf("unable to create token file: %v", err)
+	}
+
+	var renewals int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/kubernetes/login" {
+			var login map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&login)
+			if login["role"] != "zipkin" || login["jwt"] != "service-account-jwt" {
+				w.WriteHeader(403)
+				_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"s.k8s"}}`))
+			return
+		}
+		if token := r.Header.Get("X-Vault-Token"); token != "s.root" && token != "s.k8s" {
+			w.WriteHeader(403)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/zipkin":
+			_, _ = w.Write([]byte(vaultKVv1))
+		case "/v1/kv/data/zipkin":
+			_, _ = w.Write([]byte(vaultKVv2))
+		case "/v1/database/creds/zipkin":
+			_, _ = w.Write([]byte(vaultDB))
+		case "/v1/sys/leases/renew":
+			// the max TTL is reached on the second renewal
+			duration := 1
+			if atomic.AddInt32(&renewals, 1) > 1 {
+				duration = 0
+			}
+			_, _ = w.Write([]byte(`{"lease_id":"database/creds/zipkin/6YWVPFq0BIwkIfsepBSY8dn3","renewable":true,"lease_duration":` +
+				strconv.Itoa(duration) + `}`))
+		default:
+			w.WriteHeader(404)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer srv.Close()
+
+	for _, item := range []struct {
+		name      string
+		cfg       credentials.VaultConfig
+		tpls      credentials.Templates
+		want      credentials.Credentials
+		wantLease bool
+		wantErr   bool
+	}{
+		{
+			name: "kv v1",
+			cfg:  credentials.VaultConfig{Token: "s.root", SecretPath: "secret/zipkin"},
+			want: credentials.Credentials{Username: "zipkin", Password: "kv1-secret"},
+		},
+		{
+			name: "kv v2",
+			cfg:  credentials.VaultConfig{Token: "s.root", SecretPath: "kv/data/zipkin"},
+			want: credentials.Credentials{APIKey: "VuaCfGcBCdbkQm-e5aOx:ui2lp2axTNmsyakw9tvNnw"},
+		},
+		{
+			name: "database kubernetes auth",
+			cfg:  credentials.VaultConfig{KubernetesRole: "zipkin", KubernetesTokenFile: jwtFile, SecretPath: "database/creds/zipkin"},
+			want: credentials.Credentials{
+				Username: "v-kubernetes-zipkin-cUSnMKfKIbqWbkEhHf3o-1585155604",
+				Password: "A1a-0Ni9XOQddSDVbmiB",
+			},
+			wantLease: true,
+		},
+		{
+			name: "custom template",
+			cfg:  credentials.VaultConfig{Token: "s.root", SecretPath: "secret/zipkin"},
+			tpls: credentials.Templates{Username: "{{ .data.username }}-ro"},
+			want: credentials.Credentials{Username: "zipkin-ro", Password: "kv1-secret"},
+		},
+		{name: "wrong role", cfg: credentials.VaultConfig{KubernetesRole: "other", KubernetesTokenFile: jwtFile}, wantErr: true},
+		{name: "missing secret", cfg: credentials.VaultConfig{Token: "s.root", SecretPath: "secret/other"}, wantErr: true},
+	} {
+		item.cfg.Address = srv.URL
+		got, lease, err := readVault(item.cfg, item.tpls)
+		if item.wantErr {
+			if err == nil {
+				t.Errorf("%s: want error, got nil", item.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", item.name, err)
+			continue
+		}
+		if got != item.want {
+			t.Errorf("%s: want %+v, got %+v", item.name, item.want, got)
+		}
+		if (lease != nil) != item.wantLease {
+			t.Errorf("%s: want lease %t, got %+v", item.name, item.wantLease, lease)
+		}
+	}
+
+	// the lease is renewed until it reaches its max TTL
+	v, err := credentials.NewVault(context.Background(), credentials.VaultConfig{Address: srv.URL, Token: "s.root"})
+	if err != nil {
+		t.Fatalf("unable to create Vault client: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = v.KeepAlive(ctx, credentials.Lease{
+		ID:        "database/creds/zipkin/6YWVPFq0BIwkIfsepBSY8dn3",
+		Duration:  30 * time.Millisecond,
+		Renewable: true,
+	})
+	if err == nil {
+		t.Errorf("want max TTL error, got nil")
+	}
+	if renewals != 2 {
+		t.Errorf("want 2 renewals, got %d", renewals)
+	}
+}
+
+func readVault(cfg credentials.VaultConfig, tpls credentials.Templates) (credentials.Credentials, *credentials.Lease, error) {
+	v, err := credentials.NewVault(context.Background(), cfg)
+	if err != nil {
+		return credentials.Credentials{}, nil, err
+	}
+	return v.Read(context.Background(), tpls)
+}
+
+func TestVaultTokenRenewal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "es-templater")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	jwtFile := dir + "/token"
+	if err = ioutil.WriteFile(jwtFile, []byte("service-account-jwt\n"), 0600); err != nil {
+		t.Fatalf("unable to create token file: %v", err)
+	}
+
+	var tokenRenewals, leaseRenewals int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/kubernetes/login" {
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"s.k8s","lease_duration":1,"renewable":true}}`))
+			return
+		}
+		if r.Header.Get("X-Vault-Token") != "s.k8s" {
+			w.WriteHeader(403)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/auth/token/renew-self":
+			// the max TTL of the token is reached on the second renewal
+			duration := 1
+			if atomic.AddInt32(&tokenRenewals, 1) > 1 {
+				duration = 0
+			}
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"s.k8s","renewable":true,"lease_duration":` +
+				strconv.Itoa(duration) + `}}`))
+		case "/v1/sys/leases/renew":
+			atomic.AddInt32(&leaseRenewals, 1)
+			_, _ = w.Write([]byte(`{"lease_id":"database/creds/zipkin/6YWVPFq0BIwkIfsepBSY8dn3","renewable":true,"lease_duration":3600}`))
+		default:
+			w.WriteHeader(404)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer srv.Close()
+
+	v, err := credentials.NewVault(context.Background(), credentials.VaultConfig{
+		Address:             srv.URL,
+		KubernetesRole:      "zipkin",
+		KubernetesTokenFile: jwtFile,
+	})
+	if err != nil {
+		t.Fatalf("unable to create Vault client: %v", err)
+	}
+	// the token expires long before the lease, which is revoked with it
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = v.KeepAlive(ctx, credentials.Lease{
+		ID:        "database/creds/zipkin/6YWVPFq0BIwkIfsepBSY8dn3",
+		Duration:  time.Hour,
+		Renewable: true,
+	})
+	if err == nil {
+		t.Errorf("want token max TTL error, got nil")
+	}
+	if tokenRenewals != 2 {
+		t.Errorf("want 2 token renewals, got %d", tokenRenewals)
+	}
+	if leaseRenewals != 0 {
+		t.Errorf("want no lease renewal, got %d", leaseRenewals)
+	}
+}
@@ -0,0 +1,52 @@
+package es
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// Authenticator authenticates the requests sent to the cluster.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// BasicAuth authenticates with a username and password.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// Authenticate implements Authenticator.
+func (a BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// APIKeyAuth authenticates with an Elasticsearch API key. The key is either
+// the encoded key returned by the create API key API or "id:api_key".
+type APIKeyAuth struct {
+	APIKey string
+}
+
+// Authenticate implements Authenticator.
+func (a APIKeyAuth) Authenticate(req *http.Request) error {
+	key := a.APIKey
+	if strings.Contains(key, ":") {
+		key = base64.StdEncoding.EncodeToString([]byte(key))
+	}
+	req.Header.Set("Authorization", "ApiKey "+key)
+	return nil
+}
+
+// BearerAuth authenticates with a bearer token, e.g. an Elasticsearch service
+// account token or an OAuth2 access token.
+type BearerAuth struct {
+	Token string
+}
+
+// Authenticate implements Authenticator.
+func (a BearerAuth) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
@@ -0,0 +1,44 @@
+package es_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
+)
+
+func TestAuth(t *testing.T) {
+	for _, item := range []struct {
+		name string
+		auth es.Authenticator
+		want string
+	}{
+		{"none", nil, ""},
+		{"basic", es.BasicAuth{Username: "elastic", Password: "changeme"}, "Basic ZWxhc3RpYzpjaGFuZ2VtZQ=="},
+		{"api key", es.APIKeyAuth{APIKey: "VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw=="},
+			"ApiKey VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw=="},
+		{"api key id", es.APIKeyAuth{APIKey: "VuaCfGcBCdbkQm-e5aOx:ui2lp2axTNmsyakw9tvNnw"},
+			"ApiKey VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw=="},
+		{"bearer", es.BearerAuth{Token: "dGhpcyBpcyBhIHRva2Vu"}, "Bearer dGhpcyBpcyBhIHRva2Vu"},
+	} {
+		var got []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = append(got, r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"version":{"number":"7.10.2"}}`))
+		}))
+		cfg := es.DefaultConfig()
+		cfg.Hosts = []string{srv.URL}
+		cfg.Auth = item.auth
+		_, err := es.New(context.Background(), srv.Client(), cfg)
+		srv.Close()
+		if err != nil {
+			t.Errorf("%s: unable to create client: %v", item.name, err)
+			continue
+		}
+		if len(got) != 1 || got[0] != item.want {
+			t.Errorf("%s: want Authorization %q, got %q", item.name, item.want, got)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package es
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Error is an error response of the cluster. Type, Reason and RootCause are
+// parsed from the Elasticsearch error document, if the response holds one.
+type Error struct {
+	StatusCode int
+	Type       string
+	Reason     string
+	RootCause  []ErrorCause
+	// Body is the raw response body.
+	Body string
+}
+
+// ErrorCause type
+type ErrorCause struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+	Index  string `json:"index,omitempty"`
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	if e.Type == "" {
+		if e.Body == "" {
+			return fmt.Sprintf("status %d", e.StatusCode)
+		}
+		return fmt.Sprintf("status %d: %s", e.StatusCode, strings.TrimSpace(e.Body))
+	}
+	return fmt.Sprintf("status %d: %s: %s", e.StatusCode, e.Type, e.Reason)
+}
+
+// HasType returns true if the error or one of its root causes is of the
+// provided type, e.g. index_not_found_exception.
+func (e *Error) HasType(typ string) bool {
+	if e.Type == typ {
+		return true
+	}
+	for _, cause := range e.RootCause {
+		if cause.Type == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// IsErrorType returns true if err is an Error of the provided type, see
+// Error.HasType.
+func IsErrorType(err error, typ string) bool {
+	var esErr *Error
+	return errors.As(err, &esErr) && esErr.HasType(typ)
+}
+
+// IsNotFound returns true if err is an Error for a missing resource.
+func IsNotFound(err error) bool {
+	var esErr *Error
+	return errors.As(err, &esErr) && esErr.StatusCode == http.StatusNotFound
+}
+
+// IsTransient returns true if err is a connection error or an Error with one of
+// the statuses retried by the RetryPolicy, e.g. while the cluster is starting.
+// Authentication, authorization and TLS verification failures are not
+// transient.
+func IsTransient(err error) bool {
+	var esErr *Error
+	if errors.As(err, &esErr) {
+		return retryableStatus(esErr.StatusCode)
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// TLS handshakes rejected by the cluster are reported as "remote error"
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op != "remote error"
+}
+
+// newError returns the Error for an unsuccessful response.
+func newError(res *http.Response) error {
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	e := &Error{StatusCode: res.StatusCode, Body: string(b)}
+	var doc struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(b, &doc) != nil || len(doc.Error) == 0 {
+		return e
+	}
+	var cause struct {
+		ErrorCause
+		RootCause []ErrorCause `json:"root_cause"`
+	}
+	if json.Unmarshal(doc.Error, &cause) == nil {
+		e.Type = cause.Type
+		e.Reason = cause.Reason
+		e.RootCause = cause.RootCause
+	} else {
+		// some plugins report a plain string
+		_ = json.Unmarshal(doc.Error, &e.Reason)
+	}
+	return e
+}
+
+// success returns true for the 2xx status codes.
+func success(res *http.Response) bool {
+	return res.StatusCode >= 200 && res.StatusCode < 300
+}
@@ -0,0 +1,147 @@
+package es_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
+)
+
+func TestError(t *testing.T) {
+	for _, item := range []struct {
+		name       string
+		status     int
+		body       string
+		wantType   string
+		wantReason string
+		wantCause  string
+	}{
+		{
+			name:   "index not found",
+			status: 404,
+			body: `{"error":{"root_cause":[{"type":"index_not_found_exception","reason":"no such index [zipkin-span-2026-10-01]","index":"zipkin-span-2026-10-01"}],` +
+				`"type":"index_not_found_exception","reason":"no such index [zipkin-span-2026-10-01]"},"status":404}`,
+			wantType:   "index_not_found_exception",
+			wantReason: "no such index [zipkin-span-2026-10-01]",
+			wantCause:  "index_not_found_exception",
+		},
+		{
+			name:   "root cause",
+			status: 400,
+			body: `{"error":{"root_cause":[{"type":"illegal_argument_exception","reason":"Wildcard expressions or all indices are not allowed"}],` +
+				`"type":"illegal_argument_exception","reason":"Wildcard expressions or all indices are not allowed"},"status":400}`,
+			wantType:   "illegal_argument_exception",
+			wantReason: "Wildcard expressions or all indices are not allowed",
+			wantCause:  "illegal_argument_exception",
+		},
+		{
+			name:       "plain string",
+			status:     500,
+			body:       `{"error":"something failed"}`,
+			wantReason: "something failed",
+		},
+		{
+			name:   "not json",
+			status: 502,
+			body:   `<html>Bad Gateway</html>`,
+		},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/" {
+				_, _ = w.Write([]byte(`{"version":{"number":"7.10.2"}}`))
+				return
+			}
+			w.WriteHeader(item.status)
+			_, _ = w.Write([]byte(item.body))
+		}))
+
+		cfg := es.DefaultConfig()
+		cfg.Hosts = []string{srv.URL}
+		cfg.Retry.MaxAttempts = 1
+		client, err := es.New(context.Background(), srv.Client(), cfg)
+		if err != nil {
+			t.Fatalf("%s: unable to create client: %v", item.name, err)
+		}
+		err = client.DeleteIndices(context.Background(), []string{"zipkin-span-2026-10-01"})
+		srv.Close()
+
+		var esErr *es.Error
+		if !errors.As(err, &esErr) {
+			t.Errorf("%s: want es.Error, got: %v", item.name, err)
+			continue
+		}
+		if esErr.StatusCode != item.status {
+			t.Errorf("%s: want status: %d, got: %d", item.name, item.status, esErr.StatusCode)
+		}
+		if esErr.Type != item.wantType {
+			t.Errorf("%s: want type: %q, got: %q", item.name, item.wantType, esErr.Type)
+		}
+		if esErr.Reason != item.wantReason {
+			t.Errorf("%s: want reason: %q, got: %q", item.name, item.wantReason, esErr.Reason)
+		}
+		if item.wantCause != "" && !es.IsErrorType(err, item.wantCause) {
+			t.Errorf("%s: want error type %q", item.name, item.wantCause)
+		}
+		if es.IsErrorType(err, "security_exception") {
+			t.Errorf("%s: unexpected security_exception", item.name)
+		}
+		if es.IsNotFound(err) != (item.status == 404) {
+			t.Errorf("%s: want not found: %v", item.name, item.status == 404)
+		}
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	info := func(status int, body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(body))
+		}))
+	}
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	untrusted := httptest.NewUnstartedServer(http.NotFoundHandler())
+	untrusted.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	untrusted.StartTLS()
+
+	for _, item := range []struct {
+		name   string
+		srv    *httptest.Server
+		client *http.Client
+		want   bool
+	}{
+		{"connection refused", down, http.DefaultClient, true},
+		{"unavailable", info(503, `{"error":{"type":"master_not_discovered_exception"},"status":503}`),
+			nil, true},
+		{"too many requests", info(429, `{"error":{"type":"es_rejected_execution_exception"},"status":429}`),
+			nil, true},
+		{"unauthorized", info(401, `{"error":{"type":"security_exception","reason":"unable to authenticate user [elastic]"},"status":401}`),
+			nil, false},
+		{"forbidden", info(403, `{"error":{"type":"security_exception","reason":"action [cluster:monitor/main] is unauthorized"},"status":403}`),
+			nil, false},
+		{"unsupported version", info(200, `{"version":{"number":"not a version"}}`), nil, false},
+		{"unknown authority", untrusted, http.DefaultClient, false},
+	} {
+		client := item.client
+		if client == nil {
+			client = item.srv.Client()
+		}
+		cfg := es.DefaultConfig()
+		cfg.Hosts = []string{item.srv.URL}
+		cfg.Retry.MaxAttempts = 1
+		_, err := es.New(context.Background(), client, cfg)
+		item.srv.Close()
+		if err == nil {
+			t.Errorf("%s: want error, got nil", item.name)
+			continue
+		}
+		if got := es.IsTransient(err); got != item.want {
+			t.Errorf("%s: want transient: %v, got: %v (%v)", item.name, item.want, got, err)
+		}
+	}
+}
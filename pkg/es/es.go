@@ -2,17 +2,23 @@ package es
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
+	l "github.com/tetratelabs/log"
+
 	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
 )
 
+var log = l.RegisterScope("es", "Elasticsearch client", 0)
+
 // ClusterInfo response
 type ClusterInfo struct {
 	Name        string `json:"name"`
@@ -20,6 +26,7 @@ type ClusterInfo struct {
 	ClusterUUID string `json:"cluster_uuid"`
 	Version     struct {
 		Number                           string    `json:"number"`
+		Distribution                     string    `json:"distribution"`
 		BuildFlavor                      string    `json:"build_flavor"`
 		BuildType                        string    `json:"build_type"`
 		BuildHash                        string    `json:"build_hash"`
@@ -32,33 +39,83 @@ type ClusterInfo struct {
 	Tagline string `json:"tagline"`
 }
 
+// compatMediaType is the versioned media type Elasticsearch 8.x clients use to
+// opt into REST API compatibility for the major version they were built for.
+// See: https://www.elastic.co/guide/en/elasticsearch/reference/8.0/rest-api-compatibility.html
+const compatMediaType = "application/vnd.elasticsearch+json; compatible-with=8"
+
+// Config holds the settings of a Client.
+type Config struct {
+	// Hosts are the base URLs of the cluster nodes to send requests to, see
+	// ParseHosts. Connection errors move the requests to the next host.
+	Hosts []string
+	// Sniff replaces the Hosts with the data nodes of the cluster once
+	// connected, see Client.Sniff.
+	Sniff bool
+	// Auth authenticates the requests, nil sends them unauthenticated.
+	Auth  Authenticator
+	Retry RetryPolicy
+	// RequestTimeout limits each attempt of a request, including reading the
+	// response body. 0 means no timeout.
+	RequestTimeout time.Duration
+}
+
+// DefaultConfig returns a Config object with default settings initialized.
+func DefaultConfig() Config {
+	return Config{
+		Hosts: []string{"http://localhost:9200"},
+		Retry: DefaultRetryPolicy(),
+	}
+}
+
 // Client holds an ES client for Zipkin specific ES management.
 type Client struct {
-	client    *http.Client
-	host      string
-	basicAuth func(req *http.Request)
-	ci        ClusterInfo
-	version   float64
+	client  *http.Client
+	hosts   *hostPool
+	auth    Authenticator
+	retry   RetryPolicy
+	ci      ClusterInfo
+	version templater.Version
 }
 
-// NewClient returns a new Zipkin specific ES management Client.
-func NewClient(client *http.Client, host, user, pass string) (*Client, error) {
+// NewClient returns a new Zipkin specific ES management Client using the
+// default retry policy. The host may be a comma separated list of hosts.
+func NewClient(ctx context.Context, client *http.Client, host, user, pass string) (*Client, error) {
+	cfg := DefaultConfig()
+	cfg.Hosts = ParseHosts(host)
+	if user != "" || pass != "" {
+		cfg.Auth = BasicAuth{Username: user, Password: pass}
+	}
+	return New(ctx, client, cfg)
+}
+
+// New returns a new Zipkin specific ES management Client for the provided
+// configuration. The context is used to retrieve the cluster info only.
+func New(ctx context.Context, client *http.Client, cfg Config) (*Client, error) {
 	if client == nil {
 		client = http.DefaultClient
 	}
+	if cfg.RequestTimeout > 0 {
+		// copy to not change the timeout of a shared http.Client
+		withTimeout := *client
+		withTimeout.Timeout = cfg.RequestTimeout
+		client = &withTimeout
+	}
+	if cfg.Retry.MaxAttempts < 1 {
+		cfg.Retry.MaxAttempts = 1
+	}
+	if len(cfg.Hosts) == 0 {
+		return nil, errors.New("no hosts")
+	}
 
 	c := Client{
-		client:    client,
-		host:      host,
-		basicAuth: func(_ *http.Request) {},
-	}
-	if user != "" || pass != "" {
-		c.basicAuth = func(req *http.Request) {
-			req.SetBasicAuth(user, pass)
-		}
+		client: client,
+		hosts:  &hostPool{hosts: append([]string(nil), cfg.Hosts...)},
+		auth:   cfg.Auth,
+		retry:  cfg.Retry,
 	}
 
-	ci, err := c.getClusterInfo()
+	ci, err := c.getClusterInfo(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -68,26 +125,46 @@ func NewClient(client *http.Client, host, user, pass string) (*Client, error) {
 		return nil, err
 	}
 
+	if cfg.Sniff {
+		if err = c.Sniff(ctx); err != nil {
+			return nil, fmt.Errorf("unable to sniff nodes: %w", err)
+		}
+	}
+
 	return &c, nil
 }
 
-func (c *Client) getClusterInfo() (*ClusterInfo, error) {
-	req, err := http.NewRequest("GET", c.host, nil)
+// newRequest returns a request for the provided path with the ES version
+// specific headers set. The host and authentication are set per attempt, see
+// do.
+func (c Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	if !c.version.IsOpenSearch() && c.version.AtLeast(8, 0) {
+		req.Header.Set("Accept", compatMediaType)
+		if body != nil {
+			req.Header.Set("Content-Type", compatMediaType)
+		}
+	} else if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func (c *Client) getClusterInfo(ctx context.Context) (*ClusterInfo, error) {
+	req, err := c.newRequest(ctx, "GET", "", nil)
 	if err != nil {
 		return nil, err
 	}
-	c.basicAuth(req)
-	res, err := c.client.Do(req)
+	res, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		b, err := ioutil.ReadAll(res.Body)
-		if err != nil {
-			return nil, err
-		}
-		return nil, errors.New(string(b))
+	if !success(res) {
+		return nil, newError(res)
 	}
 	var ci ClusterInfo
 	if err = json.NewDecoder(res.Body).Decode(&ci); err != nil {
@@ -97,36 +174,91 @@ func (c *Client) getClusterInfo() (*ClusterInfo, error) {
 	return &ci, nil
 }
 
-func (c Client) parseVersion() (float64, error) {
-	v := strings.Split(c.ci.Version.Number, ".")
-	if len(v) != 3 {
-		return 0.0, errors.New("invalid version number")
+func (c Client) parseVersion() (templater.Version, error) {
+	// Elasticsearch does not report a distribution, OpenSearch does.
+	d := templater.Elasticsearch
+	if strings.EqualFold(c.ci.Version.Distribution, string(templater.OpenSearch)) {
+		d = templater.OpenSearch
 	}
-	return strconv.ParseFloat(v[0]+"."+v[1], 64)
+	return templater.ParseVersion(d, c.ci.Version.Number)
 }
 
-// Version returns the ES version of the registered ES host.
-func (c Client) Version() float64 {
+// Version returns the ES or OpenSearch version of the registered host.
+func (c Client) Version() templater.Version {
 	return c.version
 }
 
 // SetIndexTemplate tries to insert provided template
-func (c Client) SetIndexTemplate(templateName string, tpl templater.Template) (string, error) {
+func (c Client) SetIndexTemplate(ctx context.Context, templateName string, tpl templater.Template) (string, error) {
+	return c.put(ctx, "/_template/"+templateName, tpl)
+}
+
+// DeleteIndex removes indexes. Clusters enforcing
+// action.destructive_requires_name reject wildcards, see DeleteIndices.
+func (c Client) DeleteIndex(ctx context.Context, indexName string) (string, error) {
+	return c.delete(ctx, "/"+indexName)
+}
+
+// GetTemplates returns templates given provided template pattern. The
+// templates are returned as served by the cluster, see templater.Diff.
+func (c Client) GetTemplates(ctx context.Context, tplPattern string) (map[string]json.RawMessage, error) {
+	tpls := make(map[string]json.RawMessage)
+	if err := c.get(ctx, "/_template/"+tplPattern+"?local=false", &tpls); err != nil {
+		return nil, err
+	}
+	return tpls, nil
+}
+
+// get decodes the response of path into v. A not found response leaves v
+// untouched.
+func (c Client) get(ctx context.Context, path string, v interface{}) error {
+	req, err := c.newRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return nil
+	}
+	if !success(res) {
+		return newError(res)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// put sends v as JSON to path and returns the response body. Unsuccessful
+// responses are returned as Error.
+func (c Client) put(ctx context.Context, path string, v interface{}) (string, error) {
+	return c.send(ctx, "PUT", path, v)
+}
+
+// post sends v as JSON to path and returns the response body. Unsuccessful
+// responses are returned as Error.
+func (c Client) post(ctx context.Context, path string, v interface{}) (string, error) {
+	return c.send(ctx, "POST", path, v)
+}
+
+func (c Client) send(ctx context.Context, method, path string, v interface{}) (string, error) {
 	buf := new(bytes.Buffer)
-	if err := json.NewEncoder(buf).Encode(tpl); err != nil {
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
 		return "", err
 	}
-	req, err := http.NewRequest("PUT", c.host+"/_template/"+templateName, buf)
+	req, err := c.newRequest(ctx, method, path, buf)
 	if err != nil {
 		return "", err
 	}
-	c.basicAuth(req)
-	req.Header.Add("Content-Type", "application/json")
-	res, err := c.client.Do(req)
+	res, err := c.do(req)
 	if err != nil {
 		return "", err
 	}
 	defer res.Body.Close()
+	if !success(res) {
+		return "", newError(res)
+	}
 
 	b, err := ioutil.ReadAll(res.Body)
 	if err != nil {
@@ -136,48 +268,51 @@ func (c Client) SetIndexTemplate(templateName string, tpl templater.Template) (s
 	return string(b), nil
 }
 
-// DeleteIndex removes indexes
-func (c Client) DeleteIndex(indexName string) (string, error) {
-	req, err := http.NewRequest("DELETE", c.host+"/"+indexName, nil)
+// exchange sends body as JSON to path and decodes the response into v.
+// Unsuccessful responses are returned as Error.
+func (c Client) exchange(ctx context.Context, method, path string, body, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		buf := new(bytes.Buffer)
+		if err := json.NewEncoder(buf).Encode(body); err != nil {
+			return err
+		}
+		r = buf
+	}
+	req, err := c.newRequest(ctx, method, path, r)
 	if err != nil {
-		return "", err
+		return err
 	}
-	c.basicAuth(req)
-	res, err := c.client.Do(req)
+	res, err := c.do(req)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer res.Body.Close()
-	b, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return "", err
+	if !success(res) {
+		return newError(res)
 	}
-
-	return string(b), nil
+	return json.NewDecoder(res.Body).Decode(v)
 }
 
-// GetTemplates returns templates given provided template pattern.
-func (c Client) GetTemplates(tplPattern string) (map[string]templater.Template, error) {
-	req, err := http.NewRequest("GET", c.host+"/_template/"+tplPattern+"?local=false", nil)
+// delete removes the resource at path and returns the response body.
+// Unsuccessful responses are returned as Error.
+func (c Client) delete(ctx context.Context, path string) (string, error) {
+	req, err := c.newRequest(ctx, "DELETE", path, nil)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	c.basicAuth(req)
-	res, err := c.client.Do(req)
+	res, err := c.do(req)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	defer res.Body.Close()
-	if res.StatusCode != 200 && res.StatusCode != 404 {
-		b, err := ioutil.ReadAll(res.Body)
-		if err != nil {
-			return nil, err
-		}
-		return nil, errors.New(string(b))
+	if !success(res) {
+		return "", newError(res)
 	}
-	tpls := make(map[string]templater.Template)
-	if err = json.NewDecoder(res.Body).Decode(&tpls); err != nil {
-		return nil, err
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
 	}
-	return tpls, nil
+
+	return string(b), nil
 }
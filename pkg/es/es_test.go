@@ -0,0 +1,52 @@
+package es_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+func TestMediaType(t *testing.T) {
+	const compat = "application/vnd.elasticsearch+json; compatible-with=8"
+	for _, item := range []struct {
+		name        string
+		info        string
+		accept      string
+		contentType string
+	}{
+		{"elasticsearch 8", `{"version":{"number":"8.11.1"}}`, compat, compat},
+		{"elasticsearch 7", `{"version":{"number":"7.17.9"}}`, "", "application/json"},
+		{"opensearch 2", `{"version":{"distribution":"opensearch","number":"2.11.0"}}`, "", "application/json"},
+	} {
+		var accept, contentType string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "PUT" {
+				accept, contentType = r.Header.Get("Accept"), r.Header.Get("Content-Type")
+				_, _ = w.Write([]byte(`{"acknowledged":true}`))
+				return
+			}
+			_, _ = w.Write([]byte(item.info))
+		}))
+		cfg := es.DefaultConfig()
+		cfg.Hosts = []string{srv.URL}
+		client, err := es.New(context.Background(), srv.Client(), cfg)
+		if err == nil {
+			_, err = client.SetIndexTemplate(context.Background(), "zipkin-span", templater.Template{})
+		}
+		srv.Close()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", item.name, err)
+			continue
+		}
+		if accept != item.accept {
+			t.Errorf("%s: want Accept %q, got %q", item.name, item.accept, accept)
+		}
+		if contentType != item.contentType {
+			t.Errorf("%s: want Content-Type %q, got %q", item.name, item.contentType, contentType)
+		}
+	}
+}
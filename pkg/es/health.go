@@ -0,0 +1,44 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ClusterHealth response
+type ClusterHealth struct {
+	ClusterName   string `json:"cluster_name"`
+	Status        string `json:"status"`
+	TimedOut      bool   `json:"timed_out"`
+	NumberOfNodes int    `json:"number_of_nodes"`
+}
+
+// WaitForStatus waits up to timeout for the cluster to reach the provided
+// health status (yellow or green) and returns the cluster health. If the
+// status is not reached in time the returned health has TimedOut set.
+func (c Client) WaitForStatus(ctx context.Context, status string, timeout time.Duration) (*ClusterHealth, error) {
+	q := url.Values{}
+	q.Set("wait_for_status", status)
+	q.Set("timeout", fmt.Sprintf("%dms", timeout.Milliseconds()))
+	req, err := c.newRequest(ctx, "GET", "/_cluster/health?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	// a timed out wait is reported with 408 Request Timeout
+	if !success(res) && res.StatusCode != 408 {
+		return nil, newError(res)
+	}
+	var health ClusterHealth
+	if err := json.NewDecoder(res.Body).Decode(&health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
@@ -0,0 +1,172 @@
+package es
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ParseHosts splits a comma separated list of hosts as accepted by Zipkin's
+// ES_HOSTS. The scheme defaults to http.
+func ParseHosts(str string) []string {
+	var hosts []string
+	for _, host := range strings.Split(str, ",") {
+		host = strings.TrimSuffix(strings.TrimSpace(host), "/")
+		if host == "" {
+			continue
+		}
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// ParseCloudID returns the https endpoint of the Elasticsearch deployment
+// identified by an Elastic Cloud ID, "<name>:<base64 of host$es$kibana>". The
+// port of the host, default 443, can be overridden per component as in
+// "host:9243$es:443$kibana".
+// See: https://www.elastic.co/guide/en/cloud/current/ec-cloud-id.html
+func ParseCloudID(cloudID string) (string, error) {
+	encoded := cloudID
+	if i := strings.LastIndex(cloudID, ":"); i >= 0 {
+		encoded = cloudID[i+1:]
+	}
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		// some tools strip the padding
+		if b, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "=")); err != nil {
+			return "", fmt.Errorf("invalid cloud ID: %w", err)
+		}
+	}
+	parts := strings.Split(string(b), "$")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", errors.New("invalid cloud ID: no Elasticsearch endpoint")
+	}
+	host, port := parts[0], "443"
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host, port = h, p
+	}
+	id := parts[1]
+	if h, p, err := net.SplitHostPort(id); err == nil {
+		id, port = h, p
+	}
+	if port == "443" {
+		return "https://" + id + "." + host, nil
+	}
+	return "https://" + net.JoinHostPort(id+"."+host, port), nil
+}
+
+// hostPool holds the hosts of a Client. Requests go to the current host until
+// it fails with a connection error, after which the next host is used.
+type hostPool struct {
+	mu      sync.Mutex
+	hosts   []string
+	current int
+}
+
+func (p *hostPool) get() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.hosts[p.current]
+}
+
+func (p *hostPool) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.hosts)
+}
+
+func (p *hostPool) list() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.hosts...)
+}
+
+func (p *hostPool) set(hosts []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hosts = hosts
+	p.current = 0
+}
+
+// failover moves to the next host if the failed host is the current one. It
+// returns false if there is no other host to use.
+func (p *hostPool) failover(failed string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.hosts) < 2 {
+		return false
+	}
+	if p.hosts[p.current] == failed {
+		p.current = (p.current + 1) % len(p.hosts)
+	}
+	return true
+}
+
+// Hosts returns the hosts the Client sends requests to.
+func (c Client) Hosts() []string {
+	return c.hosts.list()
+}
+
+// Sniff replaces the hosts of the Client with the HTTP addresses of the data
+// nodes of the cluster. The scheme of the current host is kept. If no data
+// node publishes an HTTP address the hosts are left unchanged.
+func (c Client) Sniff(ctx context.Context) error {
+	var res struct {
+		Nodes map[string]struct {
+			Roles []string `json:"roles"`
+			HTTP  struct {
+				PublishAddress string `json:"publish_address"`
+			} `json:"http"`
+		} `json:"nodes"`
+	}
+	if err := c.exchange(ctx, "GET", "/_nodes/http", nil, &res); err != nil {
+		return err
+	}
+	scheme := "http"
+	if i := strings.Index(c.hosts.get(), "://"); i > 0 {
+		scheme = c.hosts.get()[:i]
+	}
+	var hosts []string
+	for _, node := range res.Nodes {
+		if !isDataNode(node.Roles) || node.HTTP.PublishAddress == "" {
+			continue
+		}
+		// the address is either ip:port or hostname/ip:port
+		addr := node.HTTP.PublishAddress
+		if i := strings.Index(addr, "/"); i >= 0 {
+			hostname, ipPort := addr[:i], addr[i+1:]
+			addr = ipPort
+			if _, port, err := net.SplitHostPort(ipPort); err == nil && hostname != "" {
+				// prefer the hostname, certificates are rarely issued for IPs
+				addr = net.JoinHostPort(hostname, port)
+			}
+		}
+		hosts = append(hosts, scheme+"://"+addr)
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+	sort.Strings(hosts)
+	log.Debugf("sniffed hosts: %s", strings.Join(hosts, ", "))
+	c.hosts.set(hosts)
+	return nil
+}
+
+// isDataNode returns true if the roles include a data role, including the
+// data tiers of Elasticsearch 7.10 and later.
+func isDataNode(roles []string) bool {
+	for _, role := range roles {
+		if role == "data" || strings.HasPrefix(role, "data_") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package es_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+func TestParseHosts(t *testing.T) {
+	for _, item := range []struct {
+		hosts string
+		want  []string
+	}{
+		{"http://localhost:9200", []string{"http://localhost:9200"}},
+		{"https://es-0:9200, https://es-1:9200/,", []string{"https://es-0:9200", "https://es-1:9200"}},
+		{"es-0:9200,es-1:9200", []string{"http://es-0:9200", "http://es-1:9200"}},
+		{"", nil},
+	} {
+		if got := es.ParseHosts(item.hosts); !reflect.DeepEqual(got, item.want) {
+			t.Errorf("%q: want: %v, got: %v", item.hosts, item.want, got)
+		}
+	}
+}
+
+func TestParseCloudID(t *testing.T) {
+	for _, item := range []struct {
+		cloudID string
+		want    string
+		wantErr bool
+	}{
+		{
+			cloudID: "my-deployment:dXMtZWFzdC0xLmF3cy5mb3VuZC5pbyRjZWM2ZjI2MWE3NGJmMjRjZTMzYmI4ODExYjg0Mjk0ZiRjNmMyY2E2ZDA0MjI0OWFmMGNjN2Q3YTllOTYyNTc0Mw==",
+			want:    "https://cec6f261a74bf24ce33bb8811b84294f.us-east-1.aws.found.io",
+		},
+		{
+			cloudID: "dXMtZWFzdC0xLmF3cy5mb3VuZC5pbyRjZWM2ZjI2MWE3NGJmMjRjZTMzYmI4ODExYjg0Mjk0ZiRjNmMyY2E2ZDA0MjI0OWFmMGNjN2Q3YTllOTYyNTc0Mw",
+			want:    "https://cec6f261a74bf24ce33bb8811b84294f.us-east-1.aws.found.io",
+		},
+		{
+			cloudID: "my-deployment:dXMtZWFzdC0xLmF3cy5mb3VuZC5pbzo5MjQzJGNlYzZmMjYxYTc0YmYyNGNlMzNiYjg4MTFiODQyOTRmJGM2YzJjYTZkMDQyMjQ5YWYwY2M3ZDdhOWU5NjI1NzQz",
+			want:    "https://cec6f261a74bf24ce33bb8811b84294f.us-east-1.aws.found.io:9243",
+		},
+		{
+			cloudID: "my-deployment:ZWFzdHVzMi5henVyZS5lbGFzdGljLWNsb3VkLmNvbTo0NDMkY2VjNmYyNjFhNzRiZjI0Y2UzM2JiODgxMWI4NDI5NGY6OTI0MyRr",
+			want:    "https://cec6f261a74bf24ce33bb8811b84294f.eastus2.azure.elastic-cloud.com:9243",
+		},
+		{cloudID: "my-deployment:dXMtZWFzdC0xLmF3cy5mb3VuZC5pbw==", wantErr: true},
+		{cloudID: "my-deployment:not base64", wantErr: true},
+	} {
+		got, err := es.ParseCloudID(item.cloudID)
+		if item.wantErr {
+			if err == nil {
+				t.Errorf("%q: want error, got nil", item.cloudID)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", item.cloudID, err)
+		}
+		if got != item.want {
+			t.Errorf("%q: want: %s, got: %s", item.cloudID, item.want, got)
+		}
+	}
+}
+
+func TestFailover(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"version":{"number":"7.10.2"}}`))
+	}))
+	defer srv.Close()
+
+	// reserve an address nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := "http://" + l.Addr().String()
+	l.Close()
+
+	// failing over does not wait for the backoff nor depend on retries
+	for _, maxAttempts := range []int{1, 2} {
+		cfg := es.DefaultConfig()
+		cfg.Hosts = []string{down, srv.URL}
+		cfg.Retry = es.RetryPolicy{MaxAttempts: maxAttempts, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if _, err := es.New(ctx, srv.Client(), cfg); err != nil {
+			t.Errorf("max attempts %d: want failover to %s, got: %v", maxAttempts, srv.URL, err)
+		}
+		cancel()
+	}
+}
+
+func TestFailoverPost(t *testing.T) {
+	var posts [2]int32
+	newServer := func(i int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" {
+				_, _ = w.Write([]byte(`{"version":{"number":"7.10.2"}}`))
+				return
+			}
+			atomic.AddInt32(&posts[i], 1)
+			_, _ = w.Write([]byte(`{"task":"oTUltX4IQMOUUVeiohTt8A:12345"}`))
+		}))
+	}
+	first, second := newServer(0), newServer(1)
+	defer second.Close()
+
+	cfg := es.DefaultConfig()
+	cfg.Hosts = []string{first.URL, second.URL}
+	cfg.Retry = es.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	transport := &http.Transport{}
+	defer transport.CloseIdleConnections()
+	client, err := es.New(context.Background(), &http.Client{Transport: transport}, cfg)
+	if err != nil {
+		t.Fatalf("unable to create client: %v", err)
+	}
+
+	// the request is not sent to the host going down, so it is safe to send
+	// it to the next one
+	first.Close()
+	transport.CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err = client.DeleteByQuery(ctx, "zipkin-span-*", &templater.Query{}); err != nil {
+		t.Errorf("want failover to %s, got: %v", second.URL, err)
+	}
+	if posts != [2]int32{0, 1} {
+		t.Errorf("want a single delete by query on the second host, got: %v", posts)
+	}
+}
+
+func TestSniff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_nodes/http":
+			_, _ = w.Write([]byte(`{"nodes":{
+				"a":{"roles":["master"],"http":{"publish_address":"10.0.0.1:9200"}},
+				"b":{"roles":["data","ingest"],"http":{"publish_address":"10.0.0.2:9200"}},
+				"c":{"roles":["data_hot"],"http":{"publish_address":"es-data-1/10.0.0.3:9200"}}}}`))
+		default:
+			_, _ = w.Write([]byte(`{"version":{"number":"7.10.2"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	cfg := es.DefaultConfig()
+	cfg.Hosts = []string{srv.URL}
+	cfg.Sniff = true
+	client, err := es.New(context.Background(), srv.Client(), cfg)
+	if err != nil {
+		t.Fatalf("unable to create client: %v", err)
+	}
+	want := []string{"http://10.0.0.2:9200", "http://es-data-1:9200"}
+	if got := client.Hosts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
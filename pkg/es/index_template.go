@@ -0,0 +1,80 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+// SupportsComposableTemplates returns true if the registered host supports the
+// composable index template (_index_template) and component template APIs.
+func (c Client) SupportsComposableTemplates() bool {
+	return c.version.SupportsComposableTemplates()
+}
+
+// SetComposableIndexTemplate tries to insert provided composable index
+// template.
+func (c Client) SetComposableIndexTemplate(ctx context.Context, templateName string, tpl templater.IndexTemplate) (string, error) {
+	return c.put(ctx, "/_index_template/"+templateName, tpl)
+}
+
+// GetComposableIndexTemplates returns composable index templates given provided
+// template pattern. The templates are returned as served by the cluster, see
+// templater.Diff.
+func (c Client) GetComposableIndexTemplates(ctx context.Context, tplPattern string) (map[string]json.RawMessage, error) {
+	var res struct {
+		IndexTemplates []struct {
+			Name          string          `json:"name"`
+			IndexTemplate json.RawMessage `json:"index_template"`
+		} `json:"index_templates"`
+	}
+	if err := c.get(ctx, "/_index_template/"+tplPattern, &res); err != nil {
+		return nil, err
+	}
+	tpls := make(map[string]json.RawMessage)
+	for _, tpl := range res.IndexTemplates {
+		tpls[tpl.Name] = tpl.IndexTemplate
+	}
+	return tpls, nil
+}
+
+// DeleteComposableIndexTemplate removes the named composable index template.
+func (c Client) DeleteComposableIndexTemplate(ctx context.Context, templateName string) (string, error) {
+	return c.delete(ctx, "/_index_template/"+templateName)
+}
+
+// SetComponentTemplate tries to insert provided component template.
+func (c Client) SetComponentTemplate(ctx context.Context, templateName string, tpl templater.ComponentTemplate) (string, error) {
+	return c.put(ctx, "/_component_template/"+templateName, tpl)
+}
+
+// GetComponentTemplates returns component templates given provided template
+// pattern. The templates are returned as served by the cluster, see
+// templater.Diff.
+func (c Client) GetComponentTemplates(ctx context.Context, tplPattern string) (map[string]json.RawMessage, error) {
+	var res struct {
+		ComponentTemplates []struct {
+			Name              string          `json:"name"`
+			ComponentTemplate json.RawMessage `json:"component_template"`
+		} `json:"component_templates"`
+	}
+	if err := c.get(ctx, "/_component_template/"+tplPattern, &res); err != nil {
+		return nil, err
+	}
+	tpls := make(map[string]json.RawMessage)
+	for _, tpl := range res.ComponentTemplates {
+		tpls[tpl.Name] = tpl.ComponentTemplate
+	}
+	return tpls, nil
+}
+
+// DeleteComponentTemplate removes the named component template.
+func (c Client) DeleteComponentTemplate(ctx context.Context, templateName string) (string, error) {
+	return c.delete(ctx, "/_component_template/"+templateName)
+}
+
+// DeleteTemplate removes the named legacy index template.
+func (c Client) DeleteTemplate(ctx context.Context, templateName string) (string, error) {
+	return c.delete(ctx, "/_template/"+templateName)
+}
@@ -0,0 +1,53 @@
+package es
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// IndexInfo holds the _cat/indices details of an index.
+type IndexInfo struct {
+	Index     string `json:"index"`
+	Health    string `json:"health"`
+	Status    string `json:"status"`
+	DocsCount string `json:"docs.count"`
+	StoreSize string `json:"store.size"`
+}
+
+// SizeInBytes returns the store size of the index in bytes.
+func (i IndexInfo) SizeInBytes() int64 {
+	n, _ := strconv.ParseInt(i.StoreSize, 10, 64)
+	return n
+}
+
+// GetIndices returns the indices matching the provided index pattern.
+func (c Client) GetIndices(ctx context.Context, indexPattern string) ([]IndexInfo, error) {
+	var indices []IndexInfo
+	if err := c.get(ctx, "/_cat/indices/"+indexPattern+
+		"?format=json&bytes=b&s=index&h=index,health,status,docs.count,store.size", &indices); err != nil {
+		return nil, err
+	}
+	return indices, nil
+}
+
+// DeleteIndices removes the provided concrete indices, which works on clusters
+// enforcing action.destructive_requires_name (the default since 8.0).
+func (c Client) DeleteIndices(ctx context.Context, indices []string) error {
+	if len(indices) == 0 {
+		return nil
+	}
+	req, err := c.newRequest(ctx, "DELETE", "/"+strings.Join(indices, ","), nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if !success(res) {
+		return newError(res)
+	}
+	return nil
+}
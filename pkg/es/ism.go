@@ -0,0 +1,96 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+// SetISMPolicy tries to insert or update provided OpenSearch ISM policy. ISM
+// requires updates to reference the sequence number and primary term of the
+// current policy, these are retrieved first.
+func (c Client) SetISMPolicy(ctx context.Context, policyName string, policy templater.ISMPolicy) (string, error) {
+	var current struct {
+		SeqNo       *int64 `json:"_seq_no"`
+		PrimaryTerm *int64 `json:"_primary_term"`
+	}
+	path := "/_plugins/_ism/policies/" + policyName
+	if err := c.get(ctx, path, &current); err != nil {
+		return "", err
+	}
+	if current.SeqNo != nil && current.PrimaryTerm != nil {
+		path += fmt.Sprintf("?if_seq_no=%d&if_primary_term=%d",
+			*current.SeqNo, *current.PrimaryTerm)
+	}
+	return c.put(ctx, path, policy)
+}
+
+// GetISMPolicy returns the named ISM policy as served by the cluster, see
+// templater.Diff. It returns nil if the policy does not exist.
+func (c Client) GetISMPolicy(ctx context.Context, policyName string) (json.RawMessage, error) {
+	var policy json.RawMessage
+	if err := c.get(ctx, "/_plugins/_ism/policies/"+policyName, &policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// DeleteISMPolicy removes the named ISM policy.
+func (c Client) DeleteISMPolicy(ctx context.Context, policyName string) (string, error) {
+	return c.delete(ctx, "/_plugins/_ism/policies/"+policyName)
+}
+
+// GetISMPolicyIDs returns the ISM policy managing each index matching the
+// provided index pattern. Unmanaged indices map to an empty policy ID.
+func (c Client) GetISMPolicyIDs(ctx context.Context, indexPattern string) (map[string]string, error) {
+	res := make(map[string]json.RawMessage)
+	if err := c.get(ctx, "/_plugins/_ism/explain/"+indexPattern, &res); err != nil {
+		return nil, err
+	}
+	policies := make(map[string]string)
+	for index, raw := range res {
+		var explain struct {
+			PolicyID *string `json:"index.plugins.index_state_management.policy_id"`
+		}
+		// skip the non index properties like total_managed_indices
+		if json.Unmarshal(raw, &explain) != nil {
+			continue
+		}
+		policies[index] = ""
+		if explain.PolicyID != nil {
+			policies[index] = *explain.PolicyID
+		}
+	}
+	return policies, nil
+}
+
+// AddISMPolicy attaches the named ISM policy to the indices matching the
+// provided index pattern. The add API reports per index failures with a
+// successful status, these are returned as error.
+func (c Client) AddISMPolicy(ctx context.Context, indexPattern, policyName string) (string, error) {
+	var res struct {
+		UpdatedIndices int  `json:"updated_indices"`
+		Failures       bool `json:"failures"`
+		FailedIndices  []struct {
+			IndexName string `json:"index_name"`
+			Reason    string `json:"reason"`
+		} `json:"failed_indices"`
+	}
+	err := c.exchange(ctx, "POST", "/_plugins/_ism/add/"+indexPattern,
+		map[string]string{"policy_id": policyName}, &res)
+	if err != nil {
+		return "", err
+	}
+	if res.Failures {
+		var failed []string
+		for _, index := range res.FailedIndices {
+			failed = append(failed, index.IndexName+": "+index.Reason)
+		}
+		return "", fmt.Errorf("policy not added to %d indices: %s",
+			len(res.FailedIndices), strings.Join(failed, ", "))
+	}
+	return fmt.Sprintf("added to %d indices", res.UpdatedIndices), nil
+}
@@ -0,0 +1,28 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+// SetLifecyclePolicy tries to insert or update provided ILM policy.
+func (c Client) SetLifecyclePolicy(ctx context.Context, policyName string, policy templater.LifecyclePolicy) (string, error) {
+	return c.put(ctx, "/_ilm/policy/"+policyName, policy)
+}
+
+// GetLifecyclePolicy returns the named ILM policy as served by the cluster, see
+// templater.Diff. It returns nil if the policy does not exist.
+func (c Client) GetLifecyclePolicy(ctx context.Context, policyName string) (json.RawMessage, error) {
+	policies := make(map[string]json.RawMessage)
+	if err := c.get(ctx, "/_ilm/policy/"+policyName, &policies); err != nil {
+		return nil, err
+	}
+	return policies[policyName], nil
+}
+
+// DeleteLifecyclePolicy removes the named ILM policy.
+func (c Client) DeleteLifecyclePolicy(ctx context.Context, policyName string) (string, error) {
+	return c.delete(ctx, "/_ilm/policy/"+policyName)
+}
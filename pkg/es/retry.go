@@ -0,0 +1,235 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how requests failing with a transient error are
+// retried. Transient errors are the network errors reported by IsTransient and
+// the 429, 502, 503 and 504 status codes. POST requests are retried on the 429 and 503 status codes
+// only.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per request, 1 disables
+	// retries.
+	MaxAttempts int
+	// InitialBackoff is the backoff before the first retry, doubled on each
+	// following retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff between attempts.
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy returns a RetryPolicy suitable to ride out a rolling
+// restart of a small cluster.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+	}
+}
+
+// backoff returns the wait before retrying the failed attempt. A Retry-After
+// header sent by the cluster takes precedence, capped by MaxBackoff, otherwise
+// the exponential backoff is randomized to spread the retries of concurrent
+// clients.
+func (p RetryPolicy) backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if d, ok := retryAfter(res.Header.Get("Retry-After")); ok {
+			if d > p.MaxBackoff {
+				d = p.MaxBackoff
+			}
+			return d
+		}
+	}
+	d := p.InitialBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// equal jitter: half fixed, half random
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parses a Retry-After header holding either seconds or a date.
+func retryAfter(str string) (time.Duration, bool) {
+	if str == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(str); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if ts, err := http.ParseTime(str); err == nil {
+		if d := time.Until(ts); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// retryable returns true if the attempt failed with a transient error, see
+// IsTransient. Errors caused by the request context being done and errors of
+// the Authenticator are not transient. POST requests
+// are not idempotent, e.g. a retried delete by query would start a second
+// task: they are retried only when the cluster rejected them without starting
+// any work, which a failed connection or a gateway error does not guarantee.
+func retryable(req *http.Request, res *http.Response, err error) bool {
+	var authErr *authError
+	if errors.As(err, &authErr) {
+		return false
+	}
+	if req.Method == http.MethodPost {
+		return err == nil && (res.StatusCode == http.StatusTooManyRequests ||
+			res.StatusCode == http.StatusServiceUnavailable)
+	}
+	if err != nil {
+		return req.Context().Err() == nil && IsTransient(err)
+	}
+	return retryableStatus(res.StatusCode)
+}
+
+// retryableStatus returns true for the statuses of a cluster that is starting,
+// restarting or overloaded.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// do sends the request to the current host, retrying transient errors
+// according to the retry policy. A connection error moves the request to the
+// next host: a failed connection, which did not send the request, is tried
+// on the other hosts right away, see attempt; other connection errors are
+// retried on the next host. All requests of the Client go through do.
+func (c Client) do(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		host, res, err := c.attempt(req)
+		if attempt >= c.retry.MaxAttempts || !retryable(req, res, err) {
+			return res, err
+		}
+		wait := c.retry.backoff(attempt, res)
+		reason := "error: " + errString(err)
+		if res != nil {
+			reason = "status: " + res.Status
+			// drain the body so the connection can be reused
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		} else if c.hosts.failover(host) && attempt < c.hosts.len() {
+			wait = 0
+		}
+		log.Debugf("%s %s%s failed with %s, retrying in %s (attempt %d of %d)",
+			req.Method, host, req.URL.RequestURI(), reason,
+			wait.Round(time.Millisecond), attempt, c.retry.MaxAttempts)
+		if err := Sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		if err = resetBody(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends the request to the current host. If the connection fails,
+// the request was not sent and is sent to the next host right away, whatever
+// its method and the retry policy, until every host was tried. It returns the
+// host of the last try.
+func (c Client) attempt(req *http.Request) (string, *http.Response, error) {
+	for tried := 1; ; tried++ {
+		host := c.hosts.get()
+		u, err := url.Parse(host + req.URL.RequestURI())
+		if err != nil {
+			return host, nil, err
+		}
+		hostReq := req.Clone(req.Context())
+		hostReq.URL = u
+		hostReq.Host = ""
+		if c.auth != nil {
+			if err = c.auth.Authenticate(hostReq); err != nil {
+				return host, nil, &authError{err: err}
+			}
+		}
+
+		res, err := c.client.Do(hostReq)
+		if err == nil || !isDialError(err) || req.Context().Err() != nil ||
+			tried >= c.hosts.len() || !c.hosts.failover(host) {
+			return host, res, err
+		}
+		log.Debugf("%s %s%s failed with error: %v, failing over to %s",
+			req.Method, host, req.URL.RequestURI(), err, c.hosts.get())
+		if err = resetBody(req); err != nil {
+			return host, nil, err
+		}
+	}
+}
+
+// authError is returned for requests the Authenticator failed to
+// authenticate, e.g. as the credentials command failed.
+type authError struct {
+	err error
+}
+
+func (e *authError) Error() string {
+	return "unable to authenticate request: " + e.err.Error()
+}
+
+func (e *authError) Unwrap() error {
+	return e.err
+}
+
+// isDialError returns true if the connection to the host failed, in which
+// case the request was not sent.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// resetBody replaces the consumed body of the request to send it again.
+func resetBody(req *http.Request) error {
+	if req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	return nil
+}
+
+// Sleep waits for the duration or until the context is done, in which case
+// the context error is returned.
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,197 @@
+package es_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+func TestRetry(t *testing.T) {
+	for _, item := range []struct {
+		name         string
+		failures     int32
+		status       int
+		retryAfter   string
+		maxAttempts  int
+		wantErr      bool
+		wantAttempts int32
+	}{
+		{name: "no failure", maxAttempts: 3, wantAttempts: 1},
+		{name: "unavailable", failures: 2, status: 503, maxAttempts: 3, wantAttempts: 3},
+		{name: "too many requests", failures: 1, status: 429, retryAfter: "0", maxAttempts: 3, wantAttempts: 2},
+		{name: "retry after above max backoff", failures: 1, status: 503, retryAfter: "3600", maxAttempts: 3, wantAttempts: 2},
+		{name: "exhausted", failures: 3, status: 502, maxAttempts: 3, wantErr: true, wantAttempts: 3},
+		{name: "disabled", failures: 1, status: 504, maxAttempts: 1, wantErr: true, wantAttempts: 1},
+		{name: "not transient", failures: 1, status: 500, maxAttempts: 3, wantErr: true, wantAttempts: 1},
+	} {
+		var attempts int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&attempts, 1) <= item.failures {
+				if item.retryAfter != "" {
+					w.Header().Set("Retry-After", item.retryAfter)
+				}
+				w.WriteHeader(item.status)
+				return
+			}
+			_, _ = w.Write([]byte(`{"version":{"number":"7.10.2"}}`))
+		}))
+
+		cfg := es.DefaultConfig()
+		cfg.Hosts = []string{srv.URL}
+		cfg.Retry = es.RetryPolicy{
+			MaxAttempts:    item.maxAttempts,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     5 * time.Millisecond,
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := es.New(ctx, srv.Client(), cfg)
+		cancel()
+		srv.Close()
+
+		if item.wantErr && err == nil {
+			t.Errorf("%s: want error, got nil", item.name)
+		}
+		if !item.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", item.name, err)
+		}
+		if attempts != item.wantAttempts {
+			t.Errorf("%s: want %d attempts, got %d", item.name, item.wantAttempts, attempts)
+		}
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	}))
+	defer srv.Close()
+
+	cfg := es.DefaultConfig()
+	cfg.Hosts = []string{srv.URL}
+	cfg.Retry.InitialBackoff = time.Minute
+	cfg.Retry.MaxBackoff = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := es.New(ctx, srv.Client(), cfg)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want deadline exceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("retry not canceled, took %s", elapsed)
+	}
+}
+
+func TestRetryPost(t *testing.T) {
+	for _, item := range []struct {
+		name         string
+		status       int // of the first delete by query, 0 drops the connection
+		wantErr      bool
+		wantAttempts int32
+	}{
+		{name: "too many requests", status: 429, wantAttempts: 2},
+		{name: "unavailable", status: 503, wantAttempts: 2},
+		{name: "gateway timeout", status: 504, wantErr: true, wantAttempts: 1},
+		{name: "connection dropped", wantErr: true, wantAttempts: 1},
+	} {
+		var attempts int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" {
+				_, _ = w.Write([]byte(`{"version":{"number":"7.10.2"}}`))
+				return
+			}
+			if atomic.AddInt32(&attempts, 1) > 1 {
+				_, _ = w.Write([]byte(`{"task":"oTUltX4IQMOUUVeiohTt8A:12345"}`))
+				return
+			}
+			if item.status == 0 {
+				// the cluster may have started the task before the connection broke
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			w.WriteHeader(item.status)
+		}))
+
+		cfg := es.DefaultConfig()
+		cfg.Hosts = []string{srv.URL}
+		cfg.Retry = es.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+		client, err := es.New(context.Background(), srv.Client(), cfg)
+		if err != nil {
+			t.Fatalf("%s: unable to create client: %v", item.name, err)
+		}
+		_, err = client.DeleteByQuery(context.Background(), "zipkin-span-*", &templater.Query{})
+		srv.Close()
+
+		if item.wantErr && err == nil {
+			t.Errorf("%s: want error, got nil", item.name)
+		}
+		if !item.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", item.name, err)
+		}
+		if attempts != item.wantAttempts {
+			t.Errorf("%s: want %d attempts, got %d", item.name, item.wantAttempts, attempts)
+		}
+	}
+}
+
+// failingAuth fails to authenticate, as a failing credentials command does.
+type failingAuth struct {
+	calls *int32
+}
+
+func (a failingAuth) Authenticate(*http.Request) error {
+	atomic.AddInt32(a.calls, 1)
+	return errors.New("credentials command failed")
+}
+
+func TestRetryPermanentErrors(t *testing.T) {
+	var handshakes int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"version":{"number":"7.10.2"}}`))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&handshakes, 1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	var authCalls int32
+	for _, item := range []struct {
+		name      string
+		client    *http.Client
+		auth      es.Authenticator
+		attempts  *int32
+		wantCalls int32
+	}{
+		// the client does not trust the certificate of the test server
+		{name: "untrusted certificate", client: &http.Client{}, attempts: &handshakes, wantCalls: 1},
+		{name: "authentication failure", client: srv.Client(), auth: failingAuth{calls: &authCalls}, attempts: &authCalls, wantCalls: 1},
+	} {
+		cfg := es.DefaultConfig()
+		cfg.Hosts = []string{srv.URL}
+		cfg.Auth = item.auth
+		cfg.Retry = es.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Minute}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := es.New(ctx, item.client, cfg)
+		cancel()
+
+		if err == nil || errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: want error without retries, got: %v", item.name, err)
+		}
+		if got := atomic.LoadInt32(item.attempts); got != item.wantCalls {
+			t.Errorf("%s: want %d attempts, got %d", item.name, item.wantCalls, got)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package es
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+)
+
+// SigV4Auth authenticates with AWS Signature Version 4, as required by Amazon
+// OpenSearch Service domains using IAM authentication.
+// See: https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_aws-signing.html
+type SigV4Auth struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials.
+	SessionToken string
+	Region       string
+	// Service is "es" for Amazon OpenSearch Service domains and "aoss" for
+	// OpenSearch Serverless collections.
+	Service string
+}
+
+// Authenticate implements Authenticator. The request is signed as sent, so it
+// has to be called once its URL is final.
+func (a SigV4Auth) Authenticate(req *http.Request) error {
+	if a.AccessKeyID == "" || a.SecretAccessKey == "" {
+		return errors.New("no AWS credentials")
+	}
+	if a.Region == "" || a.Service == "" {
+		return errors.New("AWS region and service are required")
+	}
+	var body []byte
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		body, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	bodyHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(bodyHash[:]))
+	a.sign(req, body, time.Now().UTC())
+	return nil
+}
+
+// sign sets the X-Amz-Date and Authorization headers of the request as signed
+// at the given time.
+func (a SigV4Auth) sign(req *http.Request, body []byte, now time.Time) {
+	bodyHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	if a.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.SessionToken)
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	signedHeaders, canonicalHeaders := sigV4Headers(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		sigV4Escape(path, false),
+		sigV4Query(req),
+		canonicalHeaders,
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+	scope := strings.Join([]string{now.Format("20060102"), a.Region, a.Service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.Format(sigV4TimeFormat),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + a.SecretAccessKey)
+	for _, s := range []string{now.Format("20060102"), a.Region, a.Service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, a.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// sigV4Headers returns the signed header names and the canonical headers. The
+// host, the content type and the x-amz-* headers are signed.
+func sigV4Headers(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string]string{"host": host}
+	for name, v := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			values[name] = strings.Join(v, ",")
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + strings.Join(strings.Fields(values[name]), " ") + "\n")
+	}
+	return strings.Join(names, ";"), b.String()
+}
+
+// sigV4Query returns the canonical query string, sorted by key and value.
+func sigV4Query(req *http.Request) string {
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, sigV4Escape(key, true)+"="+sigV4Escape(value, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// sigV4Escape percent-encodes all but the unreserved characters, and "/" if
+// escapeSlash is false. Paths are passed already escaped, which encodes them
+// twice as all services but S3 expect.
+func sigV4Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !escapeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,211 @@
+package es_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/es"
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+const (
+	testAccessKeyID     = "AKIDEXAMPLE"
+	testSecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+func TestSigV4(t *testing.T) {
+	for _, item := range []struct {
+		name    string
+		auth    es.SigV4Auth
+		wantErr bool
+	}{
+		{
+			name: "signed",
+			auth: es.SigV4Auth{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey, Region: "eu-west-1", Service: "es"},
+		},
+		{
+			name: "session token",
+			auth: es.SigV4Auth{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey,
+				SessionToken: "AQoDYXdzEJr", Region: "eu-west-1", Service: "es"},
+		},
+		{
+			name:    "wrong secret",
+			auth:    es.SigV4Auth{AccessKeyID: testAccessKeyID, SecretAccessKey: "wrong", Region: "eu-west-1", Service: "es"},
+			wantErr: true,
+		},
+		{
+			name:    "wrong region",
+			auth:    es.SigV4Auth{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey, Region: "us-east-1", Service: "es"},
+			wantErr: true,
+		},
+	} {
+		// stand-in for an Amazon OpenSearch Service domain verifying the
+		// signature of each request, failing the first one to test that
+		// retries are signed as well
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			if err := verifySigV4(r, body, "eu-west-1", "es"); err != nil {
+				w.WriteHeader(403)
+				fmt.Fprintf(w, `{"message":%q}`, err.Error())
+				return
+			}
+			if atomic.AddInt32(&requests, 1) == 1 {
+				w.WriteHeader(503)
+				return
+			}
+			if r.URL.Path == "/" {
+				_, _ = w.Write([]byte(`{"version":{"number":"2.11.0","distribution":"opensearch"}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"task":"node:1"}`))
+		}))
+
+		cfg := es.DefaultConfig()
+		cfg.Hosts = []string{srv.URL}
+		cfg.Auth = item.auth
+		cfg.Retry.InitialBackoff = time.Millisecond
+		client, err := es.New(context.Background(), srv.Client(), cfg)
+		if err == nil {
+			query := &templater.Query{Query: templater.QueryClause{"match_all": map[string]interface{}{}}}
+			_, err = client.DeleteByQuery(context.Background(), "zipkin-span-*", query)
+		}
+		srv.Close()
+
+		if item.wantErr {
+			var esErr *es.Error
+			if !errors.As(err, &esErr) || esErr.StatusCode != 403 {
+				t.Errorf("%s: want status 403, got %v", item.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", item.name, err)
+		}
+	}
+}
+
+// TestSigV4Vectors signs requests of the AWS SigV4 test suite, as the verifier
+// above shares the canonicalization rules of the signer.
+// See: https://docs.aws.amazon.com/general/latest/gr/signature-v4-test-suite.html
+func TestSigV4Vectors(t *testing.T) {
+	auth := es.SigV4Auth{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey, Region: "us-east-1", Service: "service"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	for _, item := range []struct {
+		name   string
+		method string
+		url    string
+		want   string
+	}{
+		{"get-vanilla", "GET", "https://example.amazonaws.com/",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"get-vanilla-query-order-key-case", "GET", "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		{"post-vanilla", "POST", "https://example.amazonaws.com/",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"},
+	} {
+		req, err := http.NewRequest(item.method, item.url, nil)
+		if err != nil {
+			t.Fatalf("%s: unable to create request: %v", item.name, err)
+		}
+		auth.SignAt(req, nil, now)
+		if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+			t.Errorf("%s: want X-Amz-Date 20150830T123600Z, got: %s", item.name, got)
+		}
+		if got := req.Header.Get("Authorization"); got != item.want {
+			t.Errorf("%s: want Authorization:\n%s\ngot:\n%s", item.name, item.want, got)
+		}
+	}
+}
+
+// verifySigV4 verifies the signature of the request as AWS does, following
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html
+func verifySigV4(r *http.Request, body []byte, region, service string) error {
+	var credential, signedHeaders, signature string
+	for _, part := range strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 "), ", ") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return errors.New("malformed authorization header")
+		}
+		switch kv[0] {
+		case "Credential":
+			credential = kv[1]
+		case "SignedHeaders":
+			signedHeaders = kv[1]
+		case "Signature":
+			signature = kv[1]
+		}
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	ts, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil || time.Since(ts) > 5*time.Minute {
+		return errors.New("invalid request date")
+	}
+	scope := ts.Format("20060102") + "/" + region + "/" + service + "/aws4_request"
+	if credential != testAccessKeyID+"/"+scope {
+		return fmt.Errorf("invalid credential scope %q", credential)
+	}
+	payloadHash := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(payloadHash[:]) {
+		return errors.New("payload hash mismatch")
+	}
+	if r.Header.Get("X-Amz-Security-Token") != "" && !strings.Contains(signedHeaders, "x-amz-security-token") {
+		return errors.New("security token not signed")
+	}
+
+	escape := func(s string) string {
+		return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+	var segments []string
+	for _, segment := range strings.Split(r.URL.EscapedPath(), "/") {
+		segments = append(segments, escape(segment))
+	}
+	var params []string
+	for key, values := range r.URL.Query() {
+		for _, value := range values {
+			params = append(params, escape(key)+"\x00"+escape(value))
+		}
+	}
+	sort.Strings(params)
+	var headers strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	canonicalRequest := r.Method + "\n" +
+		strings.Join(segments, "/") + "\n" +
+		strings.ReplaceAll(strings.Join(params, "&"), "\x00", "=") + "\n" +
+		headers.String() + "\n" +
+		signedHeaders + "\n" +
+		hex.EncodeToString(payloadHash[:])
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	mac := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	key := mac(mac(mac(mac([]byte("AWS4"+testSecretAccessKey), ts.Format("20060102")), region), service), "aws4_request")
+	if !hmac.Equal([]byte(signature), []byte(hex.EncodeToString(mac(key, stringToSign)))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
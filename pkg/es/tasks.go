@@ -0,0 +1,109 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+// CountDocuments returns the number of documents in indices matching the query.
+func (c Client) CountDocuments(ctx context.Context, indexPattern string, query *templater.Query) (int64, error) {
+	var res struct {
+		Count int64 `json:"count"`
+	}
+	if err := c.exchange(ctx, "POST", "/"+indexPattern+"/_count", query, &res); err != nil {
+		return 0, err
+	}
+	return res.Count, nil
+}
+
+// CountDocumentsByIndex returns the number of documents matching the query per
+// index, leaving out indices without matches.
+func (c Client) CountDocumentsByIndex(ctx context.Context, indexPattern string, query *templater.Query) (map[string]int64, error) {
+	body := struct {
+		*templater.Query
+		Size int                    `json:"size"`
+		Aggs map[string]interface{} `json:"aggs"`
+	}{
+		Query: query,
+		Aggs: map[string]interface{}{
+			"indices": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "_index", "size": 10000},
+			},
+		},
+	}
+	var res struct {
+		Aggregations struct {
+			Indices struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int64  `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"indices"`
+		} `json:"aggregations"`
+	}
+	if err := c.exchange(ctx, "POST", "/"+indexPattern+"/_search", body, &res); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64)
+	for _, bucket := range res.Aggregations.Indices.Buckets {
+		counts[bucket.Key] = bucket.DocCount
+	}
+	return counts, nil
+}
+
+// DeleteByQuery starts an asynchronous delete by query task on the indices
+// matching the pattern and returns its task ID. Version conflicts, caused by
+// documents written while the task runs, do not abort the task.
+func (c Client) DeleteByQuery(ctx context.Context, indexPattern string, query *templater.Query) (string, error) {
+	var res struct {
+		Task string `json:"task"`
+	}
+	path := "/" + indexPattern + "/_delete_by_query?wait_for_completion=false&conflicts=proceed"
+	if err := c.exchange(ctx, "POST", path, query, &res); err != nil {
+		return "", err
+	}
+	if res.Task == "" {
+		return "", fmt.Errorf("no task returned for delete by query on %q", indexPattern)
+	}
+	return res.Task, nil
+}
+
+// GetTask returns the state of the task.
+func (c Client) GetTask(ctx context.Context, taskID string) (*Task, error) {
+	var task Task
+	if err := c.exchange(ctx, "GET", "/_tasks/"+url.PathEscape(taskID), nil, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// Task type
+type Task struct {
+	Completed bool            `json:"completed"`
+	Task      TaskInfo        `json:"task"`
+	Error     json.RawMessage `json:"error,omitempty"`
+	Response  *TaskResponse   `json:"response,omitempty"`
+}
+
+// TaskInfo type
+type TaskInfo struct {
+	Status TaskStatus `json:"status"`
+}
+
+// TaskStatus holds the progress of a by query task.
+type TaskStatus struct {
+	Total            int64 `json:"total"`
+	Deleted          int64 `json:"deleted"`
+	Batches          int64 `json:"batches"`
+	VersionConflicts int64 `json:"version_conflicts"`
+}
+
+// TaskResponse holds the result of a completed by query task.
+type TaskResponse struct {
+	Deleted  int64             `json:"deleted"`
+	Failures []json.RawMessage `json:"failures"`
+}
@@ -0,0 +1,208 @@
+package es
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSConfig holds the TLS settings to connect to a cluster over https.
+type TLSConfig struct {
+	// CABundle is the PEM file of the CA certificates to trust.
+	CABundle string
+	// CAFingerprint is the SHA-256 fingerprint of a certificate of the chain
+	// to trust, as printed by Elasticsearch 8.x on first start. It is used if
+	// no CABundle is set.
+	CAFingerprint string
+	// ClientCert and ClientKey are the PEM files of the client certificate
+	// and its private key for mutual TLS. The files are reloaded when they
+	// change.
+	ClientCert string
+	ClientKey  string
+	// ClientKeyPassword decrypts an encrypted ClientKey.
+	ClientKeyPassword string
+}
+
+// NewTLSConfig returns the tls.Config for the provided settings.
+func NewTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{}
+	if cfg.CABundle != "" {
+		b, err := ioutil.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load ca-bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if ok := pool.AppendCertsFromPEM(b); !ok {
+			return nil, errors.New("not a valid ca-bundle")
+		}
+		tlsCfg.RootCAs = pool
+	} else if cfg.CAFingerprint != "" {
+		// the chain is verified against the pinned certificate instead
+		tlsCfg.InsecureSkipVerify = true
+		tlsCfg.VerifyConnection = verifyFingerprint(cfg.CAFingerprint)
+	}
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		if cfg.ClientCert == "" || cfg.ClientKey == "" {
+			return nil, errors.New("client certificate and key are both required")
+		}
+		r := &certReloader{
+			certFile: cfg.ClientCert,
+			keyFile:  cfg.ClientKey,
+			password: cfg.ClientKeyPassword,
+		}
+		if _, err := r.load(); err != nil {
+			return nil, err
+		}
+		tlsCfg.GetClientCertificate = r.GetClientCertificate
+	}
+	return tlsCfg, nil
+}
+
+// verifyFingerprint returns a connection verifier accepting a peer chain that
+// contains a certificate matching the provided SHA-256 fingerprint, and whose
+// leaf is signed by that certificate and valid for the server name. The server
+// name is not checked for IP address hosts as it is not known to the verifier.
+func verifyFingerprint(fingerprint string) func(tls.ConnectionState) error {
+	want := strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("no peer certificate presented")
+		}
+		roots := x509.NewCertPool()
+		pinned := false
+		for _, cert := range cs.PeerCertificates {
+			sum := sha256.Sum256(cert.Raw)
+			if hex.EncodeToString(sum[:]) == want {
+				roots.AddCert(cert)
+				pinned = true
+			}
+		}
+		if !pinned {
+			return errors.New("no certificate in chain matches the ca-fingerprint")
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+			DNSName:       cs.ServerName,
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return fmt.Errorf("certificate not signed by the ca-fingerprint certificate: %w", err)
+		}
+		return nil
+	}
+}
+
+// certReloader provides the client certificate, reloading it on handshakes
+// once the certificate or key file changed, e.g. when cert-manager renews it.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	password string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate. If the
+// changed files can not be loaded, e.g. while they are being replaced, the
+// previous certificate is used.
+func (r *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, err := r.load()
+	if err != nil {
+		log.Errorf("unable to reload client certificate, using the previous one: %v", err)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.cert, nil
+	}
+	return cert, nil
+}
+
+// load returns the client certificate, loading it if the files changed since
+// the last load.
+func (r *certReloader) load() (*tls.Certificate, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load client certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load client key: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cert != nil && certInfo.ModTime().Equal(r.certMod) && keyInfo.ModTime().Equal(r.keyMod) {
+		return r.cert, nil
+	}
+	cert, err := loadX509KeyPair(r.certFile, r.keyFile, r.password)
+	if err != nil {
+		return nil, err
+	}
+	if r.cert != nil {
+		log.Infof("reloaded client certificate %s", r.certFile)
+	}
+	r.cert, r.certMod, r.keyMod = &cert, certInfo.ModTime(), keyInfo.ModTime()
+	return r.cert, nil
+}
+
+// loadX509KeyPair loads a PEM encoded certificate and private key. Encrypted
+// PKCS#8 keys and keys encrypted the legacy OpenSSL way (Proc-Type:
+// 4,ENCRYPTED) are decrypted with the password.
+func loadX509KeyPair(certFile, keyFile, password string) (tls.Certificate, error) {
+	certPEM, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to load client certificate: %w", err)
+	}
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to load client key: %w", err)
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return tls.Certificate{}, errors.New("not a valid client key")
+	}
+	//nolint:staticcheck // legacy PEM encryption is what OpenSSL writes with -traditional
+	encrypted := block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block)
+	if encrypted && password == "" {
+		return tls.Certificate{}, errors.New("client key is encrypted, no password provided")
+	}
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		der, err := decryptPKCS8(block.Bytes, password)
+		if err == nil {
+			// a wrong password may still yield valid padding
+			_, err = x509.ParsePKCS8PrivateKey(der)
+		}
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("unable to decrypt client key: %w", err)
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	case encrypted:
+		//nolint:staticcheck // see above
+		der, err := x509.DecryptPEMBlock(block, []byte(password))
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("unable to decrypt client key: %w", err)
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der})
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("invalid client certificate: %w", err)
+	}
+	return cert, nil
+}
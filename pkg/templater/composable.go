@@ -0,0 +1,123 @@
+// Copyright 2020 The OpenZipkin Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except
+// in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License
+// is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing permissions and limitations under
+// the License.
+
+package templater
+
+// constants
+const (
+	ComponentSuffix = "_component"
+
+	// name of the component template holding the index settings shared by all
+	// Zipkin index templates.
+	sharedSettingsName = "settings"
+)
+
+// Composable index templates (_index_template) replace the legacy _template API
+// which is deprecated since Elasticsearch 7.8. OpenSearch supports them in all
+// versions. Each Zipkin index template is composed of a shared settings
+// component and a component holding the type specific mappings and settings.
+// See: https://www.elastic.co/guide/en/elasticsearch/reference/7.8/index-templates.html
+
+// SettingsComponentKey returns the fully named key of the component template
+// holding the shared index settings.
+func (s Service) SettingsComponentKey() string {
+	return s.cfg.IndexPrefix + s.indexTypeDelimiter + sharedSettingsName +
+		ComponentSuffix
+}
+
+// ComponentTemplateKey returns the fully named key of the component template
+// for indexTypeName.
+func (s Service) ComponentTemplateKey(indexTypeName IndexTemplateType) string {
+	return s.cfg.IndexPrefix + s.indexTypeDelimiter + string(indexTypeName) +
+		ComponentSuffix
+}
+
+// SettingsComponentTemplate returns the component template holding the index
+// settings shared by all Zipkin index templates.
+func (s Service) SettingsComponentTemplate() ComponentTemplate {
+	settings := s.indexProperties()
+	return ComponentTemplate{
+		Template: TemplateBody{Settings: &settings},
+	}
+}
+
+// ComponentTemplateByType returns a generated component template holding the
+// mappings and type specific settings for the provided type.
+func (s Service) ComponentTemplateByType(t IndexTemplateType) *ComponentTemplate {
+	tpl := s.TemplateByType(t)
+	if tpl == nil {
+		return nil
+	}
+	c := ComponentTemplate{
+		Template: TemplateBody{Mappings: tpl.Mappings},
+	}
+	if tpl.Settings.Analysis != nil || tpl.Settings.Index.LifecycleName != "" {
+		c.Template.Settings = &Settings{
+			Index:    Index{LifecycleName: tpl.Settings.Index.LifecycleName},
+			Analysis: tpl.Settings.Analysis,
+		}
+	}
+	return &c
+}
+
+// DefaultTemplatePriority is the default priority of the composable index
+// templates. Elasticsearch rejects index templates with overlapping patterns
+// and the same priority, so it is above the default of 0 and the priority of
+// 100 of the built-in templates.
+const DefaultTemplatePriority = 200
+
+// IndexTemplateByType returns a generated composable index template for the
+// provided type. The referenced component templates need to exist before the
+// index template can be created.
+func (s Service) IndexTemplateByType(t IndexTemplateType) *IndexTemplate {
+	tpl := s.TemplateByType(t)
+	if tpl == nil {
+		return nil
+	}
+	return &IndexTemplate{
+		IndexPatterns: tpl.IndexPatterns,
+		ComposedOf: []string{
+			s.SettingsComponentKey(),
+			s.ComponentTemplateKey(t),
+		},
+		Priority: s.cfg.TemplatePriority,
+	}
+}
+
+// IndexTemplate type
+type IndexTemplate struct {
+	IndexPatterns []string      `json:"index_patterns"`
+	ComposedOf    []string      `json:"composed_of,omitempty"`
+	Priority      int           `json:"priority,omitempty"`
+	Template      *TemplateBody `json:"template,omitempty"`
+}
+
+// Serialize returns a serialized IndexTemplate object.
+func (t IndexTemplate) Serialize(pretty bool) (string, error) {
+	return serialize(t, pretty)
+}
+
+// ComponentTemplate type
+type ComponentTemplate struct {
+	Template TemplateBody `json:"template"`
+}
+
+// Serialize returns a serialized ComponentTemplate object.
+func (t ComponentTemplate) Serialize(pretty bool) (string, error) {
+	return serialize(t, pretty)
+}
+
+// TemplateBody type
+type TemplateBody struct {
+	Settings *Settings   `json:"settings,omitempty"`
+	Mappings interface{} `json:"mappings,omitempty"`
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 The OpenZipkin Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except
+// in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License
+// is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing permissions and limitations under
+// the License.
+
+package templater_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+func TestIndexTemplateByType(t *testing.T) {
+	for _, item := range []struct {
+		name     string
+		version  templater.Version
+		prefix   string
+		priority int
+		typ      templater.IndexTemplateType
+		want     templater.IndexTemplate
+	}{
+		{"span", templater.ElasticsearchVersion(7, 10), "zipkin", 0, templater.SpanType,
+			templater.IndexTemplate{
+				IndexPatterns: []string{"zipkin-span-*"},
+				ComposedOf:    []string{"zipkin-settings_component", "zipkin-span_component"},
+			}},
+		{"dependency with priority", templater.ElasticsearchVersion(8, 11), "zipkin", 500, templater.DependencyType,
+			templater.IndexTemplate{
+				IndexPatterns: []string{"zipkin-dependency-*"},
+				ComposedOf:    []string{"zipkin-settings_component", "zipkin-dependency_component"},
+				Priority:      500,
+			}},
+		{"autocomplete with prefix", templater.OpenSearchVersion(2, 11), "tracing", 10, templater.AutoCompleteType,
+			templater.IndexTemplate{
+				IndexPatterns: []string{"tracing-autocomplete-*"},
+				ComposedOf:    []string{"tracing-settings_component", "tracing-autocomplete_component"},
+				Priority:      10,
+			}},
+	} {
+		cfg := templater.DefaultConfig()
+		cfg.IndexPrefix = item.prefix
+		cfg.TemplatePriority = item.priority
+		svc, err := templater.New(cfg, item.version)
+		if err != nil {
+			t.Fatalf("unable to create service: %v", err)
+		}
+		got := svc.IndexTemplateByType(item.typ)
+		if got == nil {
+			t.Errorf("%s: want index template, got nil", item.name)
+			continue
+		}
+		if !reflect.DeepEqual(*got, item.want) {
+			t.Errorf("%s: want: %+v, got: %+v", item.name, item.want, *got)
+		}
+		// the settings component comes first so type specific settings win
+		if got.ComposedOf[0] != svc.SettingsComponentKey() || got.ComposedOf[1] != svc.ComponentTemplateKey(item.typ) {
+			t.Errorf("%s: want composed of settings and %s components, got: %v", item.name, item.typ, got.ComposedOf)
+		}
+	}
+
+	// without a priority the template collides with other templates matching
+	// its patterns
+	svc, err := templater.New(templater.DefaultConfig(), templater.ElasticsearchVersion(8, 11))
+	if err != nil {
+		t.Fatalf("unable to create service: %v", err)
+	}
+	got, err := svc.IndexTemplateByType(templater.SpanType).Serialize(false)
+	if err != nil {
+		t.Fatalf("unable to serialize: %v", err)
+	}
+	if !strings.Contains(got, `"priority":200`) {
+		t.Errorf("want default priority %d, got: %s", templater.DefaultTemplatePriority, got)
+	}
+}
+
+func TestComponentTemplateByType(t *testing.T) {
+	for _, item := range []struct {
+		name          string
+		version       templater.Version
+		strict        bool
+		retention     int
+		typ           templater.IndexTemplateType
+		wantSettings  bool
+		wantAnalysis  bool
+		wantLifecycle string
+	}{
+		{"span", templater.ElasticsearchVersion(7, 10), true, 0, templater.SpanType, false, false, ""},
+		{"span with retention", templater.ElasticsearchVersion(7, 10), true, 7, templater.SpanType,
+			true, false, "zipkin-span_policy"},
+		{"span without strict trace ID", templater.ElasticsearchVersion(7, 10), false, 0, templater.SpanType,
+			true, true, ""},
+		{"dependency", templater.ElasticsearchVersion(8, 11), true, 0, templater.DependencyType, false, false, ""},
+		{"autocomplete on OpenSearch", templater.OpenSearchVersion(2, 11), true, 7, templater.AutoCompleteType,
+			false, false, ""},
+	} {
+		cfg := templater.DefaultConfig()
+		cfg.StrictTraceID = item.strict
+		cfg.SpanRetentionDays = item.retention
+		cfg.AutoCompleteRetentionDays = item.retention
+		svc, err := templater.New(cfg, item.version)
+		if err != nil {
+			t.Fatalf("unable to create service: %v", err)
+		}
+
+		shared := svc.SettingsComponentTemplate()
+		if shared.Template.Mappings != nil {
+			t.Errorf("%s: want no mappings in the settings component, got: %v", item.name, shared.Template.Mappings)
+		}
+		if shared.Template.Settings == nil || shared.Template.Settings.Index.NumberOfShards != "5" ||
+			shared.Template.Settings.Index.NumberOfReplicas != "1" {
+			t.Errorf("%s: want shards and replicas in the settings component, got: %+v", item.name, shared.Template.Settings)
+		}
+
+		got := svc.ComponentTemplateByType(item.typ)
+		if got == nil {
+			t.Errorf("%s: want component template, got nil", item.name)
+			continue
+		}
+		if !reflect.DeepEqual(got.Template.Mappings, svc.TemplateByType(item.typ).Mappings) {
+			t.Errorf("%s: want the mappings of the legacy template, got: %v", item.name, got.Template.Mappings)
+		}
+		if (got.Template.Settings != nil) != item.wantSettings {
+			t.Errorf("%s: want settings: %v, got: %+v", item.name, item.wantSettings, got.Template.Settings)
+		}
+		if got.Template.Settings == nil {
+			continue
+		}
+		index := got.Template.Settings.Index
+		if index.NumberOfShards != "" || index.NumberOfReplicas != "" || index.RequestsCacheEnable {
+			t.Errorf("%s: want shared settings only in the settings component, got: %+v", item.name, index)
+		}
+		if (got.Template.Settings.Analysis != nil) != item.wantAnalysis {
+			t.Errorf("%s: want analysis: %v, got: %+v", item.name, item.wantAnalysis, got.Template.Settings.Analysis)
+		}
+		if index.LifecycleName != item.wantLifecycle {
+			t.Errorf("%s: want lifecycle name %q, got: %q", item.name, item.wantLifecycle, index.LifecycleName)
+		}
+	}
+}
+
+func TestDiffComponentTemplate(t *testing.T) {
+	svc, err := templater.New(templater.DefaultConfig(), templater.ElasticsearchVersion(7, 10))
+	if err != nil {
+		t.Fatalf("unable to create service: %v", err)
+	}
+
+	for _, item := range []struct {
+		name      string
+		want      interface{}
+		current   string
+		wantPaths []string
+	}{
+		{"settings in sync", svc.SettingsComponentTemplate(), `{
+  "template": {
+    "settings": {"index": {"number_of_shards": "5", "number_of_replicas": "1", "requests": {"cache": {"enable": "true"}}}}
+  },
+  "version": 1
+}`, nil},
+		{"settings drifted", svc.SettingsComponentTemplate(), `{
+  "template": {
+    "settings": {"index": {"number_of_shards": "3", "number_of_replicas": "1", "requests": {"cache": {"enable": "true"}}}}
+  }
+}`, []string{"template.settings.index.number_of_shards"}},
+		{"mappings drifted", svc.ComponentTemplateByType(templater.DependencyType), `{
+  "template": {"mappings": {"enabled": true}}
+}`, []string{"template.mappings.enabled"}},
+		{"settings overriding the settings component", svc.ComponentTemplateByType(templater.DependencyType), `{
+  "template": {"settings": {"index": {"number_of_shards": "1"}}, "mappings": {"enabled": false}}
+}`, []string{"template.settings.index.number_of_shards"}},
+	} {
+		diffs, err := templater.Diff(item.want, json.RawMessage(item.current))
+		if err != nil {
+			t.Fatalf("%s: unable to diff: %v", item.name, err)
+		}
+		if len(diffs) != len(item.wantPaths) {
+			t.Fatalf("%s: want %d differences, got: %v", item.name, len(item.wantPaths), diffs)
+		}
+		for i, diff := range diffs {
+			if diff.Path != item.wantPaths[i] {
+				t.Errorf("%s: want difference at %s, got: %s", item.name, item.wantPaths[i], diff)
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2020 The OpenZipkin Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except
+// in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License
+// is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing permissions and limitations under
+// the License.
+
+package templater
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mapping parameters which can appear at the root of an untyped mapping. A
+// mapping root holding a single key not in this list is a typed (pre 7.0)
+// mapping.
+var rootMappingParams = map[string]bool{
+	"_all": true, "_field_names": true, "_meta": true, "_routing": true,
+	"_source": true, "date_detection": true, "dynamic": true,
+	"dynamic_date_formats": true, "dynamic_templates": true, "enabled": true,
+	"numeric_detection": true, "properties": true, "runtime": true,
+}
+
+// top level properties the server fills with defaults, only the values we set
+// are compared (e.g. lifecycle policy actions get delete_searchable_snapshot).
+var serverDefaults = map[string]bool{
+	"policy": true,
+}
+
+// Difference describes a single drifted value of a template. An empty Want or
+// Got means the value is absent on that side.
+type Difference struct {
+	Path string
+	Want string
+	Got  string
+}
+
+func (d Difference) String() string {
+	switch {
+	case d.Want == "":
+		return fmt.Sprintf("%s: unexpected %s", d.Path, d.Got)
+	case d.Got == "":
+		return fmt.Sprintf("%s: missing, want %s", d.Path, d.Want)
+	default:
+		return fmt.Sprintf("%s: want %s, got %s", d.Path, d.Want, d.Got)
+	}
+}
+
+// Diff semantically compares a generated template (Template, IndexTemplate or
+// ComponentTemplate) or retention policy (LifecyclePolicy, ISMPolicy) with the
+// JSON the cluster returns for it. Elasticsearch normalizations are taken into
+// account: settings are returned with string values in nested form under the
+// index namespace, mappings may come back typed or untyped, and top level
+// properties the server adds (order, aliases, version, _meta) are ignored.
+func Diff(want interface{}, got json.RawMessage) ([]Difference, error) {
+	b, err := json.Marshal(want)
+	if err != nil {
+		return nil, err
+	}
+	var w, g map[string]interface{}
+	if err = json.Unmarshal(b, &w); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(got, &g); err != nil {
+		return nil, err
+	}
+
+	wf, gf := flattenTemplate(w), flattenTemplate(g)
+
+	var diffs []Difference
+	for path, wv := range wf {
+		if gv := gf[path]; gv != wv {
+			diffs = append(diffs, Difference{Path: path, Want: wv, Got: gv})
+		}
+	}
+	for path, gv := range gf {
+		if _, found := wf[path]; found {
+			continue
+		}
+		// only the template contents are ours, other top level properties
+		// are either added by the server or not managed by us.
+		top := strings.SplitN(path, ".", 2)[0]
+		if _, found := w[top]; !found || serverDefaults[top] {
+			continue
+		}
+		diffs = append(diffs, Difference{Path: path, Got: gv})
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+
+	return diffs, nil
+}
+
+// flattenTemplate returns the normalized template as dotted paths holding
+// string values.
+func flattenTemplate(tpl map[string]interface{}) map[string]string {
+	out := make(map[string]string)
+	for key, value := range tpl {
+		switch key {
+		case "settings":
+			flattenSettings(key, value, out)
+		case "mappings":
+			flatten(key, untypedMappings(value), out)
+		case "template":
+			// composable and component templates nest settings and mappings
+			body, _ := value.(map[string]interface{})
+			for k, v := range body {
+				switch k {
+				case "settings":
+					flattenSettings(key+"."+k, v, out)
+				case "mappings":
+					flatten(key+"."+k, untypedMappings(v), out)
+				default:
+					flatten(key+"."+k, v, out)
+				}
+			}
+		default:
+			flatten(key, value, out)
+		}
+	}
+	return out
+}
+
+// flattenSettings flattens settings into the index namespace, the server
+// returns "analysis" as "index.analysis".
+func flattenSettings(prefix string, settings interface{}, out map[string]string) {
+	flat := make(map[string]string)
+	flatten("", settings, flat)
+	for k, v := range flat {
+		k = strings.TrimPrefix(k, ".")
+		if !strings.HasPrefix(k, "index.") {
+			k = "index." + k
+		}
+		out[prefix+"."+k] = v
+	}
+}
+
+// untypedMappings strips the mapping type of typed mappings.
+func untypedMappings(mappings interface{}) interface{} {
+	m, ok := mappings.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return mappings
+	}
+	for k, v := range m {
+		if _, ok := v.(map[string]interface{}); ok && !rootMappingParams[k] {
+			return v
+		}
+	}
+	return mappings
+}
+
+func flatten(prefix string, value interface{}, out map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, sub := range v {
+			flatten(prefix+"."+k, sub, out)
+		}
+	case []interface{}:
+		for i, sub := range v {
+			flatten(prefix+"."+strconv.Itoa(i), sub, out)
+		}
+	case nil:
+	case string:
+		out[prefix] = v
+	case bool:
+		out[prefix] = strconv.FormatBool(v)
+	case float64:
+		out[prefix] = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		out[prefix] = fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 The OpenZipkin Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except
+// in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License
+// is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing permissions and limitations under
+// the License.
+
+package templater_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+// templates as served by the cluster
+const (
+	dependency68 = `{
+  "order": 0,
+  "index_patterns": ["zipkin:dependency-*"],
+  "settings": {
+    "index": {
+      "mapper": {"dynamic": "false"},
+      "requests": {"cache": {"enable": "true"}},
+      "number_of_shards": "5",
+      "number_of_replicas": "1"
+    }
+  },
+  "mappings": {"dependency": {"enabled": false}},
+  "aliases": {}
+}`
+
+	span710 = `{
+  "order": 0,
+  "index_patterns": ["zipkin-span-*"],
+  "settings": {
+    "index": {
+      "requests": {"cache": {"enable": "true"}},
+      "number_of_shards": "3",
+      "number_of_replicas": "1",
+      "analysis": {
+        "filter": {"traceId_filter": {"type": "pattern_capture", "preserve_original": "true", "patterns": ["([0-9a-f]{1,16})$"]}},
+        "analyzer": {"traceId_analyzer": {"filter": ["traceId_filter"], "type": "custom", "tokenizer": "keyword"}}
+      }
+    }
+  },
+  "mappings": {
+    "properties": {
+      "annotations": {"enabled": false},
+      "tags": {"enabled": false},
+      "traceId": {"fielddata": true, "analyzer": "traceId_analyzer", "type": "text"}
+    }
+  },
+  "aliases": {}
+}`
+)
+
+func TestDiff(t *testing.T) {
+	cfg := templater.DefaultConfig()
+	cfg.SearchEnabled = false
+
+	for _, item := range []struct {
+		name      string
+		version   templater.Version
+		typ       templater.IndexTemplateType
+		current   string
+		wantPaths []string
+	}{
+		{"typed mappings and string settings", templater.ElasticsearchVersion(6, 8),
+			templater.DependencyType, dependency68, nil},
+		{"shards and stale traceId mapping", templater.ElasticsearchVersion(7, 10),
+			templater.SpanType, span710, []string{
+				"mappings.properties.traceId.analyzer",
+				"mappings.properties.traceId.fielddata",
+				"mappings.properties.traceId.norms",
+				"mappings.properties.traceId.type",
+				"settings.index.analysis.analyzer.traceId_analyzer.filter.0",
+				"settings.index.analysis.analyzer.traceId_analyzer.tokenizer",
+				"settings.index.analysis.analyzer.traceId_analyzer.type",
+				"settings.index.analysis.filter.traceId_filter.patterns.0",
+				"settings.index.analysis.filter.traceId_filter.preserve_original",
+				"settings.index.analysis.filter.traceId_filter.type",
+				"settings.index.number_of_shards",
+			}},
+	} {
+		svc, err := templater.New(cfg, item.version)
+		if err != nil {
+			t.Fatalf("unable to create service: %v", err)
+		}
+		diffs, err := templater.Diff(*svc.TemplateByType(item.typ), json.RawMessage(item.current))
+		if err != nil {
+			t.Fatalf("%s: unable to diff: %v", item.name, err)
+		}
+		if len(diffs) != len(item.wantPaths) {
+			t.Fatalf("%s: want %d differences, got: %v", item.name, len(item.wantPaths), diffs)
+		}
+		for i, diff := range diffs {
+			if diff.Path != item.wantPaths[i] {
+				t.Errorf("%s: want difference at %s, got: %s", item.name, item.wantPaths[i], diff)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 The OpenZipkin Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except
+// in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License
+// is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing permissions and limitations under
+// the License.
+
+package templater
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// OpenSearch does not support ILM, retention is expressed as an Index State
+// Management (ISM) policy instead. The policy transitions indices to a delete
+// state once they reach the configured age. Its ism_template attaches the
+// policy to newly created Zipkin indices, existing indices need to be added
+// explicitly.
+// See: https://opensearch.org/docs/2.11/im-plugin/ism/index/
+
+// ISMTemplatePriority is the ism_template priority of the Zipkin ISM policies.
+// It is unrelated to the index template priority and above the default of 0,
+// so the policies take precedence over catch-all ones when indices are created.
+const ISMTemplatePriority = 100
+
+// SupportsISM returns true if Index State Management is available, which is
+// the case for all OpenSearch versions.
+func (s Service) SupportsISM() bool {
+	return s.distribution == OpenSearch
+}
+
+// ISMPolicyByType returns a generated ISM policy deleting indices of the
+// provided type after the configured retention. It returns nil if no retention
+// is configured for the type or ISM is not supported. The policy is named
+// after LifecyclePolicyKey.
+func (s Service) ISMPolicyByType(t IndexTemplateType) *ISMPolicy {
+	days := s.cfg.RetentionDays(t)
+	if days <= 0 || !s.SupportsISM() {
+		return nil
+	}
+	return &ISMPolicy{
+		Policy: ISMPolicyBody{
+			Description:  fmt.Sprintf("Zipkin %s retention", t),
+			DefaultState: "hot",
+			States: []ISMState{
+				{
+					Name:    "hot",
+					Actions: []map[string]interface{}{},
+					Transitions: []ISMTransition{{
+						StateName:  "delete",
+						Conditions: map[string]string{"min_index_age": strconv.Itoa(days) + "d"},
+					}},
+				},
+				{
+					Name:        "delete",
+					Actions:     []map[string]interface{}{{"delete": struct{}{}}},
+					Transitions: []ISMTransition{},
+				},
+			},
+			ISMTemplate: []ISMTemplate{{
+				IndexPatterns: []string{s.IndexPattern(t)},
+				Priority:      ISMTemplatePriority,
+			}},
+		},
+	}
+}
+
+// ISMPolicy type
+type ISMPolicy struct {
+	Policy ISMPolicyBody `json:"policy"`
+}
+
+// Serialize returns a serialized ISMPolicy object.
+func (p ISMPolicy) Serialize(pretty bool) (string, error) {
+	return serialize(p, pretty)
+}
+
+// ISMPolicyBody type
+type ISMPolicyBody struct {
+	Description  string        `json:"description,omitempty"`
+	DefaultState string        `json:"default_state"`
+	States       []ISMState    `json:"states"`
+	ISMTemplate  []ISMTemplate `json:"ism_template,omitempty"`
+}
+
+// ISMState type
+type ISMState struct {
+	Name        string                   `json:"name"`
+	Actions     []map[string]interface{} `json:"actions"`
+	Transitions []ISMTransition          `json:"transitions"`
+}
+
+// ISMTransition type
+type ISMTransition struct {
+	StateName  string            `json:"state_name"`
+	Conditions map[string]string `json:"conditions,omitempty"`
+}
+
+// ISMTemplate type
+type ISMTemplate struct {
+	IndexPatterns []string `json:"index_patterns"`
+	Priority      int      `json:"priority"`
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The OpenZipkin Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except
+// in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License
+// is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing permissions and limitations under
+// the License.
+
+package templater_test
+
+import (
+	"testing"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+func TestISMPolicyByType(t *testing.T) {
+	for _, item := range []struct {
+		name        string
+		version     templater.Version
+		prefix      string
+		retention   int
+		typ         templater.IndexTemplateType
+		wantAge     string
+		wantPattern string
+	}{
+		{"span", templater.OpenSearchVersion(2, 11), "zipkin", 7, templater.SpanType, "7d", "zipkin-span-*"},
+		{"dependency with prefix", templater.OpenSearchVersion(1, 3), "tracing", 30, templater.DependencyType,
+			"30d", "tracing-dependency-*"},
+		{"no retention", templater.OpenSearchVersion(2, 11), "zipkin", 0, templater.SpanType, "", ""},
+		{"Elasticsearch", templater.ElasticsearchVersion(7, 10), "zipkin", 7, templater.SpanType, "", ""},
+	} {
+		cfg := templater.DefaultConfig()
+		cfg.IndexPrefix = item.prefix
+		cfg.TemplatePriority = 500
+		cfg.SpanRetentionDays = item.retention
+		cfg.DependencyRetentionDays = item.retention
+		svc, err := templater.New(cfg, item.version)
+		if err != nil {
+			t.Fatalf("unable to create service: %v", err)
+		}
+
+		got := svc.ISMPolicyByType(item.typ)
+		if (got != nil) != (item.wantAge != "") {
+			t.Errorf("%s: want policy: %v, got: %+v", item.name, item.wantAge != "", got)
+		}
+		if got == nil {
+			continue
+		}
+		policy := got.Policy
+		if policy.DefaultState != "hot" || len(policy.States) != 2 {
+			t.Fatalf("%s: want hot and delete states, got: %+v", item.name, policy)
+		}
+		hot, del := policy.States[0], policy.States[1]
+		if hot.Name != "hot" || len(hot.Transitions) != 1 || hot.Transitions[0].StateName != "delete" {
+			t.Errorf("%s: want hot state transitioning to delete, got: %+v", item.name, hot)
+		} else if age := hot.Transitions[0].Conditions["min_index_age"]; age != item.wantAge {
+			t.Errorf("%s: want min_index_age %q, got: %q", item.name, item.wantAge, age)
+		}
+		if del.Name != "delete" || len(del.Actions) != 1 || len(del.Transitions) != 0 {
+			t.Errorf("%s: want final delete state, got: %+v", item.name, del)
+		} else if _, ok := del.Actions[0]["delete"]; !ok {
+			t.Errorf("%s: want delete action, got: %+v", item.name, del.Actions)
+		}
+		if len(policy.ISMTemplate) != 1 || len(policy.ISMTemplate[0].IndexPatterns) != 1 ||
+			policy.ISMTemplate[0].IndexPatterns[0] != item.wantPattern {
+			t.Errorf("%s: want ism_template for %s, got: %+v", item.name, item.wantPattern, policy.ISMTemplate)
+		} else if policy.ISMTemplate[0].Priority != templater.ISMTemplatePriority {
+			t.Errorf("%s: want ism_template priority %d, got: %d", item.name,
+				templater.ISMTemplatePriority, policy.ISMTemplate[0].Priority)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 The OpenZipkin Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except
+// in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License
+// is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing permissions and limitations under
+// the License.
+
+package templater
+
+import "strconv"
+
+// constants
+const (
+	PolicySuffix = "_policy"
+)
+
+// Zipkin writes a new index per day and type, so retention is expressed as an
+// Index Lifecycle Management (ILM) policy deleting indices once they reach the
+// configured age. The policy is referenced from the index template settings
+// through index.lifecycle.name.
+// See: https://www.elastic.co/guide/en/elasticsearch/reference/7.10/index-lifecycle-management.html
+
+// SupportsLifecycle returns true if Index Lifecycle Management is available,
+// which is the case since Elasticsearch 6.6.
+func (s Service) SupportsLifecycle() bool {
+	return s.distribution != OpenSearch && s.version.AtLeast(6, 6)
+}
+
+// LifecyclePolicyKey returns the fully named key of the lifecycle policy for
+// indexTypeName.
+func (s Service) LifecyclePolicyKey(indexTypeName IndexTemplateType) string {
+	return s.cfg.IndexPrefix + s.indexTypeDelimiter + string(indexTypeName) +
+		PolicySuffix
+}
+
+// LifecyclePolicyByType returns a generated lifecycle policy deleting indices
+// of the provided type after the configured retention. It returns nil if no
+// retention is configured for the type or ILM is not supported.
+func (s Service) LifecyclePolicyByType(t IndexTemplateType) *LifecyclePolicy {
+	days := s.cfg.RetentionDays(t)
+	if days <= 0 || !s.SupportsLifecycle() {
+		return nil
+	}
+	return &LifecyclePolicy{
+		Policy: Policy{
+			Phases: map[string]Phase{
+				"delete": {
+					MinAge:  strconv.Itoa(days) + "d",
+					Actions: map[string]interface{}{"delete": struct{}{}},
+				},
+			},
+		},
+	}
+}
+
+// LifecyclePolicy type
+type LifecyclePolicy struct {
+	Policy Policy `json:"policy"`
+}
+
+// Serialize returns a serialized LifecyclePolicy object.
+func (p LifecyclePolicy) Serialize(pretty bool) (string, error) {
+	return serialize(p, pretty)
+}
+
+// Policy type
+type Policy struct {
+	Phases map[string]Phase `json:"phases"`
+}
+
+// Phase type
+type Phase struct {
+	MinAge  string                 `json:"min_age,omitempty"`
+	Actions map[string]interface{} `json:"actions"`
+}
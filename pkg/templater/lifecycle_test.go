@@ -0,0 +1,69 @@
+// Copyright 2020 The OpenZipkin Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except
+// in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License
+// is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing permissions and limitations under
+// the License.
+
+package templater_test
+
+import (
+	"testing"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+func TestLifecyclePolicyByType(t *testing.T) {
+	for _, item := range []struct {
+		name          string
+		version       templater.Version
+		retention     int
+		typ           templater.IndexTemplateType
+		wantMinAge    string
+		wantLifecycle string
+	}{
+		{"span", templater.ElasticsearchVersion(7, 10), 7, templater.SpanType, "7d", "zipkin-span_policy"},
+		{"dependency", templater.ElasticsearchVersion(8, 11), 30, templater.DependencyType, "30d",
+			"zipkin-dependency_policy"},
+		{"first version with ILM", templater.ElasticsearchVersion(6, 6), 1, templater.AutoCompleteType, "1d",
+			"zipkin:autocomplete_policy"},
+		{"no retention", templater.ElasticsearchVersion(7, 10), 0, templater.SpanType, "", ""},
+		{"before ILM", templater.ElasticsearchVersion(6, 5), 7, templater.SpanType, "", ""},
+		{"OpenSearch", templater.OpenSearchVersion(2, 11), 7, templater.SpanType, "", ""},
+	} {
+		cfg := templater.DefaultConfig()
+		cfg.SpanRetentionDays = item.retention
+		cfg.DependencyRetentionDays = item.retention
+		cfg.AutoCompleteRetentionDays = item.retention
+		svc, err := templater.New(cfg, item.version)
+		if err != nil {
+			t.Fatalf("unable to create service: %v", err)
+		}
+
+		policy := svc.LifecyclePolicyByType(item.typ)
+		if (policy != nil) != (item.wantMinAge != "") {
+			t.Errorf("%s: want policy: %v, got: %+v", item.name, item.wantMinAge != "", policy)
+		}
+		if policy != nil {
+			phase, ok := policy.Policy.Phases["delete"]
+			if !ok || len(policy.Policy.Phases) != 1 {
+				t.Errorf("%s: want a single delete phase, got: %+v", item.name, policy.Policy.Phases)
+			}
+			if phase.MinAge != item.wantMinAge {
+				t.Errorf("%s: want min_age %q, got: %q", item.name, item.wantMinAge, phase.MinAge)
+			}
+			if _, ok = phase.Actions["delete"]; !ok || len(phase.Actions) != 1 {
+				t.Errorf("%s: want a delete action, got: %+v", item.name, phase.Actions)
+			}
+		}
+
+		if got := svc.TemplateByType(item.typ).Settings.Index.LifecycleName; got != item.wantLifecycle {
+			t.Errorf("%s: want index.lifecycle.name %q, got: %q", item.name, item.wantLifecycle, got)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 The OpenZipkin Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except
+// in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License
+// is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing permissions and limitations under
+// the License.
+
+package templater
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SpanFilter selects spans by the fields SpanIndexTemplate maps for search.
+// Empty fields do not filter.
+type SpanFilter struct {
+	ServiceName string    // localEndpoint.serviceName
+	SpanName    string    // span name
+	Tags        []string  // "key" for presence or "key=value"
+	Start       time.Time // inclusive
+	End         time.Time // exclusive
+}
+
+// IsEmpty returns true if the filter matches all spans.
+func (f SpanFilter) IsEmpty() bool {
+	return f.ServiceName == "" && f.SpanName == "" && len(f.Tags) == 0 &&
+		f.Start.IsZero() && f.End.IsZero()
+}
+
+// SpanQuery returns a query matching the spans selected by the filter. Only
+// the fields mapped by SpanIndexTemplate are used: service and span names are
+// keywords, tags are looked up in the "_q" keyword field Zipkin fills with
+// both "key" and "key=value" entries and the time range applies to
+// timestamp_millis. An empty filter is rejected to not match all spans.
+func (s Service) SpanQuery(f SpanFilter) (*Query, error) {
+	if !s.cfg.SearchEnabled {
+		return nil, errors.New("span filters require search enabled templates")
+	}
+	if f.IsEmpty() {
+		return nil, errors.New("empty span filter")
+	}
+	if !f.Start.IsZero() && !f.End.IsZero() && !f.Start.Before(f.End) {
+		return nil, errors.New("span filter start must be before end")
+	}
+
+	var filters []QueryClause
+	// Zipkin lowercases service and span names when storing spans
+	if f.ServiceName != "" {
+		filters = append(filters, term("localEndpoint.serviceName", strings.ToLower(f.ServiceName)))
+	}
+	if f.SpanName != "" {
+		filters = append(filters, term("name", strings.ToLower(f.SpanName)))
+	}
+	for _, tag := range f.Tags {
+		filters = append(filters, term("_q", tag))
+	}
+	if !f.Start.IsZero() || !f.End.IsZero() {
+		r := map[string]interface{}{"format": "epoch_millis"}
+		if !f.Start.IsZero() {
+			r["gte"] = epochMillis(f.Start)
+		}
+		if !f.End.IsZero() {
+			r["lt"] = epochMillis(f.End)
+		}
+		filters = append(filters, QueryClause{
+			"range": map[string]interface{}{"timestamp_millis": r},
+		})
+	}
+	return &Query{
+		Query: QueryClause{"bool": map[string]interface{}{"filter": filters}},
+	}, nil
+}
+
+// TraceIDQuery returns a query matching the spans of the provided traces. The
+// trace IDs are normalized the way Zipkin stores them and matched in full:
+// 128-bit IDs by all 32 characters and 64-bit IDs by 16. Without strict trace
+// ID Zipkin considers spans reported with only the lower 64 bits of a 128-bit
+// trace ID part of that trace, so 128-bit IDs are matched by their lower 64
+// bits too. As the traceId_analyzer of SpanIndexTemplate then also indexes the
+// lower 64 bits of 128-bit IDs, these match other 128-bit traces sharing them,
+// see AmbiguousTraceIDs.
+func (s Service) TraceIDQuery(traceIDs []string) (*Query, error) {
+	if len(traceIDs) == 0 {
+		return nil, errors.New("no trace IDs")
+	}
+	var (
+		ids  []string
+		seen = make(map[string]bool)
+	)
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, traceID := range traceIDs {
+		id, err := normalizeTraceID(traceID)
+		if err != nil {
+			return nil, err
+		}
+		add(id)
+		if !s.cfg.StrictTraceID && len(id) == 32 {
+			add(id[16:])
+		}
+	}
+	return &Query{
+		Query: QueryClause{"bool": map[string]interface{}{
+			"filter": []QueryClause{{"terms": map[string][]string{"traceId": ids}}},
+		}},
+	}, nil
+}
+
+// AmbiguousTraceIDs returns the normalized 64-bit trace IDs TraceIDQuery
+// matches without strict trace ID, which also match the 128-bit traces sharing
+// them as their lower 64 bits: the provided 64-bit IDs and the lower 64 bits
+// of the provided 128-bit IDs. Invalid trace IDs are skipped, TraceIDQuery
+// reports them.
+func (s Service) AmbiguousTraceIDs(traceIDs []string) []string {
+	if s.cfg.StrictTraceID {
+		return nil
+	}
+	var (
+		ids  []string
+		seen = make(map[string]bool)
+	)
+	for _, traceID := range traceIDs {
+		id, err := normalizeTraceID(traceID)
+		if err != nil {
+			continue
+		}
+		id = id[len(id)-16:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// normalizeTraceID returns the lowercase hex trace ID padded to 64 or 128 bits.
+// 128-bit IDs with the upper 64 bits unset are 64-bit IDs, as for Zipkin.
+func normalizeTraceID(traceID string) (string, error) {
+	id := strings.ToLower(strings.TrimSpace(traceID))
+	if id == "" || len(id) > 32 {
+		return "", fmt.Errorf("invalid trace ID %q", traceID)
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return "", fmt.Errorf("invalid trace ID %q", traceID)
+		}
+	}
+	if len(id) > 16 {
+		id = strings.Repeat("0", 32-len(id)) + id
+		if !strings.HasPrefix(id, strings.Repeat("0", 16)) {
+			return id, nil
+		}
+		id = id[16:]
+	}
+	return strings.Repeat("0", 16-len(id)) + id, nil
+}
+
+func term(field, value string) QueryClause {
+	return QueryClause{"term": map[string]string{field: value}}
+}
+
+func epochMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// Query type
+type Query struct {
+	Query QueryClause `json:"query"`
+}
+
+// Serialize returns a serialized Query object.
+func (q Query) Serialize(pretty bool) (string, error) {
+	return serialize(q, pretty)
+}
+
+// QueryClause type
+type QueryClause map[string]interface{}
@@ -0,0 +1,177 @@
+// Copyright 2020 The OpenZipkin Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except
+// in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License
+// is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing permissions and limitations under
+// the License.
+
+package templater_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+func TestSpanQuery(t *testing.T) {
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	for _, item := range []struct {
+		name    string
+		search  bool
+		filter  templater.SpanFilter
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "service",
+			search: true,
+			filter: templater.SpanFilter{ServiceName: "Frontend"},
+			want:   `{"query":{"bool":{"filter":[{"term":{"localEndpoint.serviceName":"frontend"}}]}}}`,
+		},
+		{
+			name:   "name and tags",
+			search: true,
+			filter: templater.SpanFilter{SpanName: "GET", Tags: []string{"error", "http.path=/login"}},
+			want:   `{"query":{"bool":{"filter":[{"term":{"name":"get"}},{"term":{"_q":"error"}},{"term":{"_q":"http.path=/login"}}]}}}`,
+		},
+		{
+			name:   "time range",
+			search: true,
+			filter: templater.SpanFilter{Start: start, End: end},
+			want:   `{"query":{"bool":{"filter":[{"range":{"timestamp_millis":{"format":"epoch_millis","gte":1792144800000,"lt":1792148400000}}}]}}}`,
+		},
+		{
+			name:   "start only",
+			search: true,
+			filter: templater.SpanFilter{Start: start},
+			want:   `{"query":{"bool":{"filter":[{"range":{"timestamp_millis":{"format":"epoch_millis","gte":1792144800000}}}]}}}`,
+		},
+		{name: "empty", search: true, wantErr: true},
+		{name: "inverted range", search: true, filter: templater.SpanFilter{Start: end, End: start}, wantErr: true},
+		{name: "search disabled", filter: templater.SpanFilter{ServiceName: "frontend"}, wantErr: true},
+	} {
+		cfg := templater.DefaultConfig()
+		cfg.SearchEnabled = item.search
+		svc, err := templater.New(cfg, templater.ElasticsearchVersion(7, 10))
+		if err != nil {
+			t.Fatalf("unable to create service: %v", err)
+		}
+		q, err := svc.SpanQuery(item.filter)
+		if item.wantErr {
+			if err == nil {
+				t.Errorf("%s: want error, got nil", item.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", item.name, err)
+			continue
+		}
+		got, err := q.Serialize(false)
+		if err != nil {
+			t.Fatalf("%s: unable to serialize: %v", item.name, err)
+		}
+		if got != item.want {
+			t.Errorf("%s:\nwant: %s\ngot:  %s", item.name, item.want, got)
+		}
+	}
+}
+
+func TestTraceIDQuery(t *testing.T) {
+	for _, item := range []struct {
+		name     string
+		strict   bool
+		traceIDs []string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "strict",
+			strict:   true,
+			traceIDs: []string{"463AC35C9F6413AD48485A3953BB6124", "abc", "0000000000000abc"},
+			want:     `{"query":{"bool":{"filter":[{"terms":{"traceId":["463ac35c9f6413ad48485a3953bb6124","0000000000000abc"]}}]}}}`,
+		},
+		{
+			name:     "mixed length",
+			traceIDs: []string{"463ac35c9f6413ad48485a3953bb6124", "48485a3953bb6124", "1463ac35c9f6413ad"},
+			want:     `{"query":{"bool":{"filter":[{"terms":{"traceId":["463ac35c9f6413ad48485a3953bb6124","48485a3953bb6124","0000000000000001463ac35c9f6413ad","463ac35c9f6413ad"]}}]}}}`,
+		},
+		{
+			// spans reported with the lower 64 bits only are part of the trace
+			name:     "128-bit",
+			traceIDs: []string{"463ac35c9f6413ad48485a3953bb6124"},
+			want:     `{"query":{"bool":{"filter":[{"terms":{"traceId":["463ac35c9f6413ad48485a3953bb6124","48485a3953bb6124"]}}]}}}`,
+		},
+		{
+			name:     "upper 64 bits unset",
+			strict:   true,
+			traceIDs: []string{"000000000000000048485a3953bb6124", "48485a3953bb6124"},
+			want:     `{"query":{"bool":{"filter":[{"terms":{"traceId":["48485a3953bb6124"]}}]}}}`,
+		},
+		{name: "none", strict: true, wantErr: true},
+		{name: "not hex", strict: true, traceIDs: []string{"463ac35c9f6413ag"}, wantErr: true},
+		{name: "too long", strict: true, traceIDs: []string{"1463ac35c9f6413ad48485a3953bb61240"}, wantErr: true},
+	} {
+		cfg := templater.DefaultConfig()
+		cfg.StrictTraceID = item.strict
+		svc, err := templater.New(cfg, templater.ElasticsearchVersion(7, 10))
+		if err != nil {
+			t.Fatalf("unable to create service: %v", err)
+		}
+		q, err := svc.TraceIDQuery(item.traceIDs)
+		if item.wantErr {
+			if err == nil {
+				t.Errorf("%s: want error, got nil", item.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", item.name, err)
+			continue
+		}
+		got, err := q.Serialize(false)
+		if err != nil {
+			t.Fatalf("%s: unable to serialize: %v", item.name, err)
+		}
+		if got != item.want {
+			t.Errorf("%s:\nwant: %s\ngot:  %s", item.name, item.want, got)
+		}
+	}
+}
+
+func TestAmbiguousTraceIDs(t *testing.T) {
+	traceIDs := []string{
+		"463ac35c9f6413ad48485a3953bb6124",
+		"48485A3953BB6124",
+		"000000000000000048485a3953bb6124",
+		"abc",
+		"not hex",
+		"1463ac35c9f6413ad",
+	}
+	for _, item := range []struct {
+		name   string
+		strict bool
+		want   []string
+	}{
+		{"strict", true, nil},
+		{"mixed length", false, []string{"48485a3953bb6124", "0000000000000abc", "463ac35c9f6413ad"}},
+	} {
+		cfg := templater.DefaultConfig()
+		cfg.StrictTraceID = item.strict
+		svc, err := templater.New(cfg, templater.ElasticsearchVersion(7, 10))
+		if err != nil {
+			t.Fatalf("unable to create service: %v", err)
+		}
+		if got := svc.AmbiguousTraceIDs(traceIDs); !reflect.DeepEqual(got, item.want) {
+			t.Errorf("%s: want: %v, got: %v", item.name, item.want, got)
+		}
+	}
+}
@@ -17,6 +17,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // IndexTemplateType for Zipkin indexes.
@@ -44,42 +46,74 @@ var (
 
 // Config holds the configuration data for a Service.
 type Config struct {
-	IndexPrefix   string
-	IndexReplicas int
-	IndexShards   int
-	SearchEnabled bool
-	StrictTraceID bool
+	IndexPrefix      string
+	IndexReplicas    int
+	IndexShards      int
+	SearchEnabled    bool
+	StrictTraceID    bool
+	TemplatePriority int // composable index templates only
+	// retention in days per index type, 0 disables the lifecycle policy
+	SpanRetentionDays         int
+	DependencyRetentionDays   int
+	AutoCompleteRetentionDays int
 }
 
 // DefaultConfig returns a Config object with default settings initialized.
 func DefaultConfig() Config {
 	return Config{
-		IndexPrefix:   "zipkin",
-		IndexReplicas: 1,
-		IndexShards:   5,
-		SearchEnabled: true,
-		StrictTraceID: true,
+		IndexPrefix:      "zipkin",
+		IndexReplicas:    1,
+		IndexShards:      5,
+		SearchEnabled:    true,
+		StrictTraceID:    true,
+		TemplatePriority: DefaultTemplatePriority,
+	}
+}
+
+// RetentionDays returns the configured retention in days for the provided
+// index type.
+func (c Config) RetentionDays(t IndexTemplateType) int {
+	switch t {
+	case AutoCompleteType:
+		return c.AutoCompleteRetentionDays
+	case DependencyType:
+		return c.DependencyRetentionDays
+	case SpanType:
+		return c.SpanRetentionDays
+	default:
+		return 0
 	}
 }
 
 // Service allows to construct ES version specific index templates for Zipkin.
 type Service struct {
 	cfg                Config
-	version            float64
+	version            Version
+	distribution       Distribution
 	indexTypeDelimiter string
 }
 
 // New returns a templating Service configured to the provided config values and
-// ES version.
-func New(config Config, version float64) (*Service, error) {
-	if version < 5.0 || version >= 8 {
+// ES or OpenSearch version.
+func New(config Config, v Version) (*Service, error) {
+	if v.IsOpenSearch() {
+		if v.Before(1, 0) || v.AtLeast(3, 0) {
+			return nil, fmt.Errorf(
+				"OpenSearch versions 1-2.x are supported, was: %s", v)
+		}
+	} else if v.Before(5, 0) || v.AtLeast(9, 0) {
 		return nil, fmt.Errorf(
-			"Elasticsearch versions 5-7.x are supported, was: %f", version)
+			"Elasticsearch versions 5-8.x are supported, was: %s", v)
 	}
 
+	// templates are generated according to the Elasticsearch version the
+	// cluster is compatible with.
+	version := v.compatibleVersion()
+
 	s := Service{
 		cfg:                config,
 		version:            version,
+		distribution:       v.Distribution,
 		indexTypeDelimiter: "-",
 	}
 
@@ -89,9 +123,11 @@ func New(config Config, version float64) (*Service, error) {
 	// names. This logic will make sure the pattern in our index template
 	// doesn't use them either.
 	// See: https://github.com/openzipkin/zipkin/issues/2219
-	if version < 7.0 {
+	if version.Before(7, 0) {
 		s.indexTypeDelimiter = ":"
 	}
+	// Elasticsearch 8.x keeps the untyped mappings introduced in 7.x and still
+	// serves the legacy _template API, so it shares the 7.x template layout.
 
 	return &s, nil
 }
@@ -115,9 +151,9 @@ func (s Service) TemplateByType(t IndexTemplateType) *Template {
 // SpanIndexTemplate returns a span index template object that satisfies the
 // provided Zipkin and ES version specific settings.
 func (s Service) SpanIndexTemplate() Template {
-	t := Template{Settings: s.indexProperties()}
+	t := Template{Settings: s.indexSettings(SpanType)}
 
-	t.setIndexName(s.version, s.indexPattern(SpanType))
+	t.setIndexName(s.version, s.IndexPattern(SpanType))
 
 	traceIDMapping := keyWord
 
@@ -203,10 +239,10 @@ func (s Service) SpanIndexTemplate() Template {
 // provided Zipkin and ES version specific settings.
 func (s Service) DependencyTemplate() Template {
 	t := Template{
-		Settings: s.indexProperties(),
+		Settings: s.indexSettings(DependencyType),
 	}
 
-	t.setIndexName(s.version, s.indexPattern(DependencyType))
+	t.setIndexName(s.version, s.IndexPattern(DependencyType))
 
 	m := Mappings{
 		Enabled: &_false,
@@ -220,10 +256,10 @@ func (s Service) DependencyTemplate() Template {
 // the provided Zipkin and ES version specific settings.
 func (s Service) AutoCompleteTemplate() Template {
 	t := Template{
-		Settings: s.indexProperties(),
+		Settings: s.indexSettings(AutoCompleteType),
 	}
 
-	t.setIndexName(s.version, s.indexPattern(AutoCompleteType))
+	t.setIndexName(s.version, s.IndexPattern(AutoCompleteType))
 
 	m := Mappings{
 		Enabled: &_true,
@@ -247,7 +283,7 @@ func (s Service) indexProperties() Settings {
 			RequestsCacheEnable: true,
 		},
 	}
-	if s.version < 7.0 {
+	if s.version.Before(7, 0) {
 		// there is no explicit documentation of index.mapper.dynamic being
 		// removed in v7, but it was.
 		settings.Index.MapperDynamic = &_false
@@ -255,10 +291,44 @@ func (s Service) indexProperties() Settings {
 	return settings
 }
 
-func (s Service) indexPattern(typ IndexTemplateType) string {
+// indexSettings returns the index settings for the provided type, which are
+// the shared index properties referencing the type's lifecycle policy.
+func (s Service) indexSettings(typ IndexTemplateType) Settings {
+	settings := s.indexProperties()
+	if s.LifecyclePolicyByType(typ) != nil {
+		settings.Index.LifecycleName = s.LifecyclePolicyKey(typ)
+	}
+	return settings
+}
+
+// IndexPattern returns the pattern matching the indices of the provided type.
+func (s Service) IndexPattern(typ IndexTemplateType) string {
 	return s.cfg.IndexPrefix + s.indexTypeDelimiter + string(typ) + "-*"
 }
 
+// RetentionDays returns the configured retention in days for the provided
+// index type.
+func (s Service) RetentionDays(t IndexTemplateType) int {
+	return s.cfg.RetentionDays(t)
+}
+
+// IndexDate returns the date of a daily Zipkin index of the provided type.
+// Zipkin suffixes its indices with the date formatted as yyyy-MM-dd where the
+// dashes are replaced with the configurable date separator, which may also be
+// empty. The boolean result is false if index is not a daily index of the type.
+func (s Service) IndexDate(typ IndexTemplateType, index, dateSeparator string) (time.Time, bool) {
+	prefix := s.IndexPrefix() + string(typ) + "-"
+	if !strings.HasPrefix(index, prefix) {
+		return time.Time{}, false
+	}
+	layout := "2006" + dateSeparator + "01" + dateSeparator + "02"
+	date, err := time.Parse(layout, strings.TrimPrefix(index, prefix))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
 // IndexPrefix returns the index prefix with the ES version specific index type
 // delimiter.
 func (s Service) IndexPrefix() string {
@@ -281,8 +351,8 @@ type Template struct {
 
 // SetIndexName sets the name of the index to the correct property given the
 // provided ES version.
-func (t *Template) setIndexName(version float64, name string) {
-	if version < 6.0 {
+func (t *Template) setIndexName(version Version, name string) {
+	if version.Before(6, 0) {
 		t.Template = name
 	} else {
 		t.IndexPatterns = []string{name}
@@ -291,14 +361,18 @@ func (t *Template) setIndexName(version float64, name string) {
 
 // Serialize returns a serialized Template object.
 func (t Template) Serialize(pretty bool) (string, error) {
+	return serialize(t, pretty)
+}
+
+func serialize(v interface{}, pretty bool) (string, error) {
 	var (
 		b   []byte
 		err error
 	)
 	if pretty {
-		b, err = json.MarshalIndent(t, "", "\t")
+		b, err = json.MarshalIndent(v, "", "\t")
 	} else {
-		b, err = json.Marshal(t)
+		b, err = json.Marshal(v)
 	}
 
 	if err != nil {
@@ -319,6 +393,7 @@ type Index struct {
 	NumberOfReplicas    string `json:"number_of_replicas,omitempty"`
 	RequestsCacheEnable bool   `json:"requests.cache.enable,omitempty"`
 	MapperDynamic       *bool  `json:"mapper.dynamic,omitempty"`
+	LifecycleName       string `json:"lifecycle.name,omitempty"`
 }
 
 // Analysis type
@@ -357,9 +432,9 @@ type MetaField struct {
 // AttachToTemplate attaches a Mappings object to an Index Template. Given the
 // version of ES it will either be a typed mapping (pre 7.0) or untyped one
 // (7.0+)
-func (m Mappings) AttachToTemplate(name IndexTemplateType, version float64) interface{} {
+func (m Mappings) AttachToTemplate(name IndexTemplateType, version Version) interface{} {
 	// ES 7.x defaults include_type_name to false https://www.elastic.co/guide/en/elasticsearch/reference/current/breaking-changes-7.0.html#_literal_include_type_name_literal_now_defaults_to_literal_false_literal
-	if version < 7.0 {
+	if version.Before(7, 0) {
 		nm := make(map[string]Mappings)
 		nm[string(name)] = m
 		return nm
@@ -0,0 +1,50 @@
+// Copyright 2020 The OpenZipkin Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except
+// in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License
+// is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing permissions and limitations under
+// the License.
+
+package templater_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+func TestIndexDate(t *testing.T) {
+	day := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	for _, item := range []struct {
+		version   templater.Version
+		index     string
+		separator string
+		wantOK    bool
+	}{
+		{templater.ElasticsearchVersion(7, 10), "zipkin-span-2026-10-16", "-", true},
+		{templater.ElasticsearchVersion(7, 10), "zipkin-span-2026.10.16", ".", true},
+		{templater.ElasticsearchVersion(7, 10), "zipkin-span-20261016", "", true},
+		{templater.ElasticsearchVersion(6, 8), "zipkin:span-2026-10-16", "-", true},
+		{templater.ElasticsearchVersion(7, 10), "zipkin-span-2026.10.16", "-", false},
+		{templater.ElasticsearchVersion(7, 10), "zipkin-dependency-2026-10-16", "-", false},
+		{templater.ElasticsearchVersion(7, 10), "zipkin-span-2026-10-16-reindexed", "-", false},
+	} {
+		svc, err := templater.New(templater.DefaultConfig(), item.version)
+		if err != nil {
+			t.Fatalf("unable to create service: %v", err)
+		}
+		got, ok := svc.IndexDate(templater.SpanType, item.index, item.separator)
+		if ok != item.wantOK {
+			t.Errorf("%s: want ok: %v, got: %v", item.index, item.wantOK, ok)
+		}
+		if ok && !got.Equal(day) {
+			t.Errorf("%s: want date: %s, got: %s", item.index, day, got)
+		}
+	}
+}
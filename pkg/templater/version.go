@@ -0,0 +1,199 @@
+// Copyright 2020 The OpenZipkin Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except
+// in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License
+// is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing permissions and limitations under
+// the License.
+
+package templater
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Distribution of the search engine serving the index templates.
+type Distribution string
+
+// supported distributions
+const (
+	Elasticsearch Distribution = "elasticsearch"
+	OpenSearch    Distribution = "opensearch"
+)
+
+// Version holds a distribution aware semantic search engine version.
+type Version struct {
+	Distribution Distribution
+	Major        int
+	Minor        int
+	Patch        int
+	PreRelease   string // e.g. "rc1" or "SNAPSHOT", empty for releases
+}
+
+// ElasticsearchVersion returns an Elasticsearch Version for the provided
+// major.minor release.
+func ElasticsearchVersion(major, minor int) Version {
+	return Version{Distribution: Elasticsearch, Major: major, Minor: minor}
+}
+
+// OpenSearchVersion returns an OpenSearch Version for the provided major.minor
+// release.
+func OpenSearchVersion(major, minor int) Version {
+	return Version{Distribution: OpenSearch, Major: major, Minor: minor}
+}
+
+// ParseVersion returns the Version of the provided distribution for a
+// "major.minor[.patch][-prerelease]" version number.
+func ParseVersion(d Distribution, number string) (Version, error) {
+	v := Version{Distribution: d}
+	number, v.PreRelease, _ = strings.Cut(number, "-")
+	parts := strings.Split(number, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid version number: %q", number)
+	}
+	for i, dst := range []*int{&v.Major, &v.Minor, &v.Patch}[:len(parts)] {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version number: %q", number)
+		}
+		*dst = n
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 if v is lower than, equal to or higher than o.
+// Pre-releases are lower than the release they precede and ordered by their
+// identifiers, see comparePreRelease. Versions are expected to be of the same
+// distribution.
+func (v Version) Compare(o Version) int {
+	for _, c := range [][2]int{
+		{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch},
+	} {
+		switch {
+		case c[0] < c[1]:
+			return -1
+		case c[0] > c[1]:
+			return 1
+		}
+	}
+	switch {
+	case v.PreRelease == o.PreRelease:
+		return 0
+	case v.PreRelease == "":
+		return 1
+	case o.PreRelease == "":
+		return -1
+	default:
+		return comparePreRelease(v.PreRelease, o.PreRelease)
+	}
+}
+
+// comparePreRelease compares pre-release tags by their identifiers the semver
+// way. Identifiers are separated by dots and at the boundaries of numbers, so
+// "rc10" is "rc" followed by 10 and follows "rc2". Numeric identifiers compare
+// as numbers and are lower than alphanumeric ones, which compare as strings. A
+// tag whose identifiers are a prefix of the other's is lower.
+func comparePreRelease(a, b string) int {
+	x, y := preReleaseIdentifiers(a), preReleaseIdentifiers(b)
+	for i := 0; i < len(x) && i < len(y); i++ {
+		n, errN := strconv.ParseUint(x[i], 10, 64)
+		m, errM := strconv.ParseUint(y[i], 10, 64)
+		switch {
+		case errN == nil && errM == nil:
+			if n != m {
+				if n < m {
+					return -1
+				}
+				return 1
+			}
+		case errN == nil:
+			return -1
+		case errM == nil:
+			return 1
+		default:
+			if c := strings.Compare(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(x) < len(y):
+		return -1
+	case len(x) > len(y):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// preReleaseIdentifiers splits a pre-release tag at dots and at the
+// boundaries between digits and other characters.
+func preReleaseIdentifiers(tag string) []string {
+	var ids []string
+	for _, part := range strings.Split(tag, ".") {
+		start := 0
+		for i := 1; i < len(part); i++ {
+			if isDigit(part[i]) != isDigit(part[i-1]) {
+				ids = append(ids, part[start:i])
+				start = i
+			}
+		}
+		ids = append(ids, part[start:])
+	}
+	return ids
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// AtLeast returns true if v is the provided major.minor release or later.
+// Pre-releases of major.minor are considered part of it.
+func (v Version) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// Before returns true if v precedes the provided major.minor release.
+func (v Version) Before(major, minor int) bool {
+	return !v.AtLeast(major, minor)
+}
+
+// IsOpenSearch returns true if the version belongs to an OpenSearch cluster.
+func (v Version) IsOpenSearch() bool {
+	return v.Distribution == OpenSearch
+}
+
+// SupportsComposableTemplates returns true if composable index templates are
+// available, which is the case since Elasticsearch 7.8 and in all OpenSearch
+// versions.
+func (v Version) SupportsComposableTemplates() bool {
+	return v.IsOpenSearch() || v.AtLeast(7, 8)
+}
+
+// compatibleVersion returns the Elasticsearch version whose template semantics
+// apply to this version. OpenSearch forked from Elasticsearch 7.10 and kept its
+// untyped mappings and legacy template API for both 1.x and 2.x.
+func (v Version) compatibleVersion() Version {
+	if v.IsOpenSearch() {
+		return ElasticsearchVersion(7, 10)
+	}
+	return v
+}
+
+func (v Version) String() string {
+	name := "Elasticsearch"
+	if v.IsOpenSearch() {
+		name = "OpenSearch"
+	}
+	s := fmt.Sprintf("%s %d.%d.%d", name, v.Major, v.Minor, v.Patch)
+	if v.PreRelease != "" {
+		s += "-" + v.PreRelease
+	}
+	return s
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 The OpenZipkin Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except
+// in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License
+// is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing permissions and limitations under
+// the License.
+
+package templater_test
+
+import (
+	"testing"
+
+	"github.com/tetratelabs/zipkin-es-templater/pkg/templater"
+)
+
+func TestParseVersion(t *testing.T) {
+	for _, item := range []struct {
+		number  string
+		want    templater.Version
+		wantErr bool
+	}{
+		{"7.10.2", templater.Version{Distribution: templater.Elasticsearch, Major: 7, Minor: 10, Patch: 2}, false},
+		{"7.1", templater.Version{Distribution: templater.Elasticsearch, Major: 7, Minor: 1}, false},
+		{"8.0.0-rc1", templater.Version{Distribution: templater.Elasticsearch, Major: 8, PreRelease: "rc1"}, false},
+		{"7", templater.Version{}, true},
+		{"7.x.1", templater.Version{}, true},
+		{"7.10.2.1", templater.Version{}, true},
+	} {
+		got, err := templater.ParseVersion(templater.Elasticsearch, item.number)
+		if (err != nil) != item.wantErr {
+			t.Errorf("%s: want error: %v, got: %v", item.number, item.wantErr, err)
+		}
+		if got != item.want {
+			t.Errorf("%s: want version: %+v, got: %+v", item.number, item.want, got)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	parse := func(number string) templater.Version {
+		v, err := templater.ParseVersion(templater.Elasticsearch, number)
+		if err != nil {
+			t.Fatalf("unable to parse %s: %v", number, err)
+		}
+		return v
+	}
+	for _, item := range []struct {
+		a, b string
+		want int
+	}{
+		{"7.10.0", "7.1.0", 1},
+		{"7.1.0", "7.10.0", -1},
+		{"7.10.2", "7.10.2", 0},
+		{"8.0.0-rc1", "8.0.0", -1},
+		{"8.0.0-rc2", "8.0.0-rc1", 1},
+		{"8.0.0-rc1", "7.17.9", 1},
+		{"8.0.0-rc10", "8.0.0-rc2", 1},
+		{"8.0.0-rc2", "8.0.0-rc10", -1},
+		{"8.0.0-rc.2", "8.0.0-rc.10", -1},
+		{"8.0.0-beta1", "8.0.0-rc1", -1},
+		{"8.0.0-alpha", "8.0.0-alpha1", -1},
+		{"8.0.0-alpha.1", "8.0.0-alpha.beta", -1},
+		{"8.0.0-1", "8.0.0-alpha", -1},
+		{"8.0.0-rc1", "8.0.0-rc1", 0},
+		{"8.0.0-SNAPSHOT", "8.0.0-rc1", -1},
+	} {
+		if got := parse(item.a).Compare(parse(item.b)); got != item.want {
+			t.Errorf("%s vs %s: want %d, got %d", item.a, item.b, item.want, got)
+		}
+	}
+}
+
+func TestVersionTable(t *testing.T) {
+	for _, item := range []struct {
+		version        templater.Version
+		wantErr        bool
+		wantPrefix     string
+		wantTemplate   bool // < 6.0 uses template instead of index_patterns
+		wantTyped      bool
+		wantMapper     bool
+		wantComposable bool
+	}{
+		{templater.ElasticsearchVersion(2, 4), true, "", false, false, false, false},
+		{templater.ElasticsearchVersion(5, 6), false, "zipkin:", true, true, true, false},
+		{templater.ElasticsearchVersion(6, 8), false, "zipkin:", false, true, true, false},
+		{templater.ElasticsearchVersion(7, 1), false, "zipkin-", false, false, false, false},
+		{templater.ElasticsearchVersion(7, 8), false, "zipkin-", false, false, false, true},
+		{templater.ElasticsearchVersion(7, 10), false, "zipkin-", false, false, false, true},
+		{templater.ElasticsearchVersion(8, 11), false, "zipkin-", false, false, false, true},
+		{templater.ElasticsearchVersion(9, 0), true, "", false, false, false, false},
+		{templater.OpenSearchVersion(0, 7), true, "", false, false, false, false},
+		{templater.OpenSearchVersion(1, 3), false, "zipkin-", false, false, false, true},
+		{templater.OpenSearchVersion(2, 11), false, "zipkin-", false, false, false, true},
+		{templater.OpenSearchVersion(3, 0), true, "", false, false, false, false},
+	} {
+		svc, err := templater.New(templater.DefaultConfig(), item.version)
+		if (err != nil) != item.wantErr {
+			t.Errorf("%s: want error: %v, got: %v", item.version, item.wantErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		if got := svc.IndexPrefix(); got != item.wantPrefix {
+			t.Errorf("%s: want prefix: %s, got: %s", item.version, item.wantPrefix, got)
+		}
+		tpl := svc.DependencyTemplate()
+		if got := tpl.Template != ""; got != item.wantTemplate {
+			t.Errorf("%s: want template property: %v, got: %v", item.version, item.wantTemplate, got)
+		}
+		_, got := tpl.Mappings.(map[string]templater.Mappings)
+		if got != item.wantTyped {
+			t.Errorf("%s: want typed mappings: %v, got: %v", item.version, item.wantTyped, got)
+		}
+		if got := tpl.Settings.Index.MapperDynamic != nil; got != item.wantMapper {
+			t.Errorf("%s: want mapper.dynamic: %v, got: %v", item.version, item.wantMapper, got)
+		}
+		if got := item.version.SupportsComposableTemplates(); got != item.wantComposable {
+			t.Errorf("%s: want composable: %v, got: %v", item.version, item.wantComposable, got)
+		}
+	}
+}